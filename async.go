@@ -0,0 +1,138 @@
+package lrucache
+
+import (
+	"errors"
+	"time"
+)
+
+// Size of the async callback queue
+const callbackQueueSize = 1024
+
+// Sets async callbacks option: eviction and expiration callbacks are run by a pool of workers,
+// so cache operations don't wait for slow callbacks. Callbacks are queued in order,
+// but several workers may run them concurrently and out of order.
+// When the queue of callbackQueueSize elements is full, callbacks are dropped rather than
+// blocking the caller; the number of dropped callbacks is reported by Stats.
+// Close runs the queued callbacks and stops the workers.
+func WithAsyncCallbacks(workers int) Option {
+	return func(l *LRUCache) error {
+		if workers <= 0 {
+			return errors.New("workers must be positive")
+		}
+
+		l.callbacks = make(chan evicted, callbackQueueSize)
+		l.workers = workers
+		return nil
+	}
+}
+
+// Starts async callback workers if they are configured, see WithAsyncCallbacks
+func (l *LRUCache) startCallbackWorkers() {
+	for range l.workers {
+		l.callbackWorkers.Add(1)
+		go func() {
+			defer l.callbackWorkers.Done()
+
+			for e := range l.callbacks {
+				l.runCallbacks(e)
+			}
+		}()
+	}
+}
+
+// Returned by SetChecked when callbacks of the elements it evicted were dropped
+var ErrCallbacksSaturated = errors.New("callback queue is full, callbacks were dropped")
+
+// Adds value to cache like SetWithResult and reports dropped callbacks of the evicted elements,
+// so the caller can apply backpressure instead of losing events silently.
+// The value is stored even if an error is returned. Other methods keep dropping callbacks silently.
+// Return: ErrCallbacksSaturated - the async callback queue is full (see WithAsyncCallbacks)
+func (l *LRUCache) SetChecked(key Key, value any) (SetResult, error) {
+	if l.rejects(key) || l.oversized(key, value) {
+		return SetResult{}, nil
+	}
+
+	l.lock()
+	result := l.setWithResult(key, value)
+	if l.release() > 0 {
+		return result, ErrCallbacksSaturated
+	}
+	return result, nil
+}
+
+// Sets callback timeout option: the caller waits for an eviction or expiration callback
+// at most timeout, then abandons it and goes on. Abandoned callbacks keep running to completion
+// in their own goroutines, the number of abandoned callbacks is reported by Stats.
+func WithCallbackTimeout(timeout time.Duration) Option {
+	return func(l *LRUCache) error {
+		if timeout <= 0 {
+			return errors.New("callback timeout must be positive")
+		}
+
+		l.callbackTimeout = timeout
+		return nil
+	}
+}
+
+// Calls callback with the safeCall guarantees, abandons it after the callback timeout
+func (l *LRUCache) watchCall(fn func()) {
+	if l.callbackTimeout <= 0 {
+		l.safeCall(fn)
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		l.safeCall(fn)
+	}()
+
+	timer := time.NewTimer(l.callbackTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+	case <-timer.C:
+		l.abandoned.Add(1)
+	}
+}
+
+// Queues element callbacks for the async workers.
+// Return: handled: true - callbacks are queued or dropped, false - the caller must run them;
+// dropped: true - the queue is full and callbacks are dropped
+func (l *LRUCache) dispatch(e evicted) (handled, dropped bool) {
+	if l.callbacks == nil {
+		return false, false
+	}
+
+	l.callbacksMu.RLock()
+	defer l.callbacksMu.RUnlock()
+
+	if l.callbacksClosed {
+		return false, false
+	}
+
+	select {
+	case l.callbacks <- e:
+		return true, false
+	default:
+		l.droppedCallbacks.Add(1)
+		return true, true
+	}
+}
+
+// Closes the async callback queue and waits for the workers to run queued callbacks
+func (l *LRUCache) stopCallbackWorkers() {
+	if l.callbacks == nil {
+		return
+	}
+
+	l.callbacksMu.Lock()
+	if !l.callbacksClosed {
+		l.callbacksClosed = true
+		close(l.callbacks)
+	}
+	l.callbacksMu.Unlock()
+
+	l.callbackWorkers.Wait()
+}
@@ -0,0 +1,268 @@
+package lrucache
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWithAsyncCallbacks(t *testing.T) {
+	t.Run("invalid workers", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 2
+		if _, err := New(cap, WithAsyncCallbacks(0)); err == nil {
+			t.Error("error expected")
+		}
+	})
+
+	t.Run("slow callback", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap     = 1
+			workers = 2
+			sets    = 10
+			delay   = 50 * time.Millisecond
+		)
+
+		var (
+			mu      sync.Mutex
+			evicted = make(map[Key]bool)
+		)
+		cache, _ := New(cap, WithAsyncCallbacks(workers), WithOnEvict(func(key Key, _ any, _ EvictReason) {
+			time.Sleep(delay)
+			mu.Lock()
+			evicted[key] = true
+			mu.Unlock()
+		}))
+
+		start := time.Now()
+		for i := range sets {
+			cache.Set(Key(strconv.Itoa(i)), i)
+		}
+		if elapsed := time.Since(start); elapsed >= delay {
+			t.Errorf("cache operations must not wait for callbacks: got = %v, want < %v", elapsed, delay)
+		}
+
+		cache.Close()
+
+		mu.Lock()
+		defer mu.Unlock()
+		for i := range sets - cap {
+			if key := Key(strconv.Itoa(i)); !evicted[key] {
+				t.Errorf("callback wasn't called for %v", key)
+			}
+		}
+		if got := cache.Stats().Dropped; got != 0 {
+			t.Errorf("no dropped callbacks expected: got = %v", got)
+		}
+	})
+
+	t.Run("full queue", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap     = 1
+			workers = 1
+			sets    = callbackQueueSize + 10
+		)
+
+		release := make(chan struct{})
+		var calls atomic.Int64
+		cache, _ := New(cap, WithAsyncCallbacks(workers), WithOnEvict(func(Key, any, EvictReason) {
+			<-release
+			calls.Add(1)
+		}))
+
+		for i := range sets + cap {
+			cache.Set(Key(strconv.Itoa(i)), i)
+		}
+		close(release)
+		cache.Close()
+
+		dropped := cache.Stats().Dropped
+		if dropped == 0 {
+			t.Error("dropped callbacks expected")
+		}
+		if got := calls.Load(); got+dropped != sets {
+			t.Errorf("every callback must be either run or dropped: got = %v + %v, want = %v", got, dropped, sets)
+		}
+	})
+
+	t.Run("after close", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap     = 1
+			workers = 2
+		)
+
+		var calls int
+		cache, _ := New(cap, WithAsyncCallbacks(workers), WithOnEvict(func(Key, any, EvictReason) {
+			calls++
+		}))
+		cache.Close()
+		cache.Close()
+
+		cache.Set("one", 1)
+		cache.Set("two", 2)
+
+		if calls != 1 {
+			t.Errorf("callback must be called synchronously: got = %v, want = %v", calls, 1)
+		}
+	})
+}
+
+func TestWithCallbackTimeout(t *testing.T) {
+	t.Run("hung callback", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap     = 1
+			timeout = 20 * time.Millisecond
+		)
+
+		release := make(chan struct{})
+		defer close(release)
+		cache, _ := New(cap, WithCallbackTimeout(timeout), WithOnEvict(func(Key, any, EvictReason) {
+			<-release
+		}))
+
+		cache.Set("one", 1)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			cache.Set("two", 2)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(10 * timeout):
+			t.Fatal("cache must unblock after the callback timeout")
+		}
+
+		if got := cache.Stats().Abandoned; got != 1 {
+			t.Errorf("invalid abandoned count: got = %v, want = %v", got, 1)
+		}
+
+		if !cache.Contains("two") {
+			t.Error("cache must keep working")
+		}
+	})
+
+	t.Run("fast callback", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap     = 1
+			timeout = time.Second
+		)
+
+		var calls atomic.Int64
+		cache, _ := New(cap, WithCallbackTimeout(timeout), WithOnEvict(func(Key, any, EvictReason) {
+			calls.Add(1)
+		}))
+		cache.Set("one", 1)
+		cache.Set("two", 2)
+
+		if calls.Load() != 1 || cache.Stats().Abandoned != 0 {
+			t.Errorf("callback must complete: got calls = %v, abandoned = %v", calls.Load(), cache.Stats().Abandoned)
+		}
+	})
+
+	t.Run("invalid timeout", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 2
+		if _, err := New(cap, WithCallbackTimeout(0)); err == nil {
+			t.Error("error expected")
+		}
+	})
+}
+
+func TestSetChecked(t *testing.T) {
+	t.Run("saturated callbacks", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap     = 1
+			workers = 1
+		)
+
+		started, release := make(chan struct{}, 1), make(chan struct{})
+		cache, _ := New(cap, WithAsyncCallbacks(workers), WithOnEvict(func(Key, any, EvictReason) {
+			select {
+			case started <- struct{}{}:
+			default:
+			}
+			<-release
+		}))
+		defer cache.Close()
+		defer close(release)
+
+		// The first callback blocks the worker, the rest fill the queue
+		cache.SetChecked("blocker", 0)
+		cache.SetChecked("0", 0)
+		<-started
+		for i := range callbackQueueSize {
+			if _, err := cache.SetChecked(Key(strconv.Itoa(i+1)), i); err != nil {
+				t.Fatalf("not expected error = %v", err)
+			}
+		}
+
+		result, err := cache.SetChecked("overflow", 0)
+		if !errors.Is(err, ErrCallbacksSaturated) {
+			t.Errorf("saturation error expected: got = %v", err)
+		}
+
+		if !result.Evicted || !cache.Contains("overflow") {
+			t.Errorf("value must be stored: got = %+v", result)
+		}
+	})
+
+	t.Run("synchronous callbacks", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 1
+		var calls int
+		cache, _ := New(cap, WithOnEvict(func(Key, any, EvictReason) { calls++ }))
+		cache.SetChecked("one", 1)
+
+		result, err := cache.SetChecked("two", 2)
+		if err != nil || !result.Evicted || result.EvictedKey != "one" || calls != 1 {
+			t.Errorf("got = %+v %v, calls = %v", result, err, calls)
+		}
+	})
+}
+
+func TestWithAsyncCallbacksStartedByNew(t *testing.T) {
+	t.Parallel()
+
+	const (
+		workers = 2
+		wait    = 50 * time.Millisecond
+	)
+
+	var calls atomic.Int64
+	cache := &LRUCache{onEvict: func(Key, any, EvictReason) { calls.Add(1) }}
+	if err := WithAsyncCallbacks(workers)(cache); err != nil {
+		t.Fatalf("got = %v, want = <nil>", err)
+	}
+
+	// A failing later option must not leave workers behind, so the option itself starts none
+	cache.callbacks <- evicted{key: "one"}
+	time.Sleep(wait)
+	if got := calls.Load(); got != 0 {
+		t.Errorf("workers must be started by New: got calls = %v, want = %v", got, 0)
+	}
+
+	cache.startCallbackWorkers()
+	cache.stopCallbackWorkers()
+	if got := calls.Load(); got != 1 {
+		t.Errorf("got calls = %v, want = %v", got, 1)
+	}
+}
@@ -0,0 +1,52 @@
+package lrucache
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Time source used for ttl calculations
+type Clock interface {
+	Now() time.Time
+}
+
+// Sets clock option used for ttl calculations instead of the system clock
+func WithClock(clock Clock) Option {
+	return func(l *LRUCache) error {
+		if clock == nil {
+			return errors.New("clock must not be nil")
+		}
+
+		l.now = clock.Now
+		return nil
+	}
+}
+
+// Manually advanced clock for tests. Intended for tests only:
+// it lets downstream packages drive cache expiration without real sleeps.
+type TestClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// Creates test clock set to the current time
+func NewTestClock() *TestClock {
+	return &TestClock{now: time.Now()}
+}
+
+// Returns the clock time
+func (c *TestClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// Moves the clock forward
+func (c *TestClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
@@ -0,0 +1,43 @@
+package lrucache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWithClock(t *testing.T) {
+	t.Parallel()
+
+	const (
+		cap   = 2
+		ttl   = time.Minute
+		ticks = 2
+	)
+
+	clock := NewTestClock()
+	cache, _ := New(cap, WithTTL(ttl, ticks), WithClock(clock))
+	defer cache.Close()
+
+	cache.Set("one", 1)
+	start := clock.Now()
+
+	clock.Advance(ttl / 2)
+	if got := clock.Now().Sub(start); got != ttl/2 {
+		t.Errorf("invalid clock advance: got = %v, want = %v", got, ttl/2)
+	}
+
+	if _, exist := cache.Get("one"); !exist {
+		t.Error("element expired too early")
+	}
+
+	clock.Advance(ttl)
+	cache.DeleteExpired()
+
+	if cache.Contains("one") {
+		t.Error("element must expire")
+	}
+
+	if _, err := New(cap, WithClock(nil)); err == nil {
+		t.Error("error expected")
+	}
+}
@@ -0,0 +1,56 @@
+package lrucache
+
+import (
+	"container/heap"
+	"time"
+)
+
+// Min-heap of expiring items ordered by expiration time.
+// Item is in the heap if and only if its expiresAt isn't zero.
+type expiryHeap []*listItem
+
+func (h expiryHeap) Len() int { return len(h) }
+
+func (h expiryHeap) Less(i, j int) bool { return h[i].expiresAt.Before(h[j].expiresAt) }
+
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].heapIdx = i
+	h[j].heapIdx = j
+}
+
+func (h *expiryHeap) Push(x any) {
+	item := x.(*listItem)
+	item.heapIdx = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *expiryHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return item
+}
+
+// Sets item expiration time keeping the expiry heap ordered, zero time means the item doesn't expire
+func (l *LRUCache) setExpiry(item *listItem, at time.Time) {
+	indexed := !item.expiresAt.IsZero()
+	item.expiresAt = at
+
+	switch {
+	case indexed && at.IsZero():
+		heap.Remove(&l.expiry, item.heapIdx)
+	case indexed:
+		heap.Fix(&l.expiry, item.heapIdx)
+	case !at.IsZero():
+		heap.Push(&l.expiry, item)
+	}
+
+	if l.wake != nil && !at.IsZero() && item.heapIdx == 0 && (l.wakeAt.IsZero() || at.Before(l.wakeAt)) {
+		select {
+		case l.wake <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package lrucache
+
+import (
+	"errors"
+	"slices"
+)
+
+// Set of cache keys
+type keySet map[Key]struct{}
+
+// Sets value index option: keyFn derives a value key from every stored value and the cache
+// keeps a reverse index from value keys to cache keys for KeysByValue. The index is updated
+// on every insert, value change and removal, keyFn is called under the cache lock and must not
+// call the cache. The index costs about one hash table entry per element plus one set per
+// distinct value key, roughly doubling the bookkeeping memory of the cache.
+func WithValueIndex(keyFn func(any) string) Option {
+	return func(l *LRUCache) error {
+		if keyFn == nil {
+			return errors.New("value key function must not be nil")
+		}
+
+		l.valueKey = keyFn
+		l.valueIndex = make(map[string]keySet)
+		return nil
+	}
+}
+
+// Returns sorted keys of elements whose value key is valueKey, see WithValueIndex.
+// Expired elements are skipped. Returns nil if the value index isn't configured.
+func (l *LRUCache) KeysByValue(valueKey string) []Key {
+	l.lock()
+	defer l.unlock()
+
+	var keys []Key
+	for key := range l.valueIndex[valueKey] {
+		if !l.expired(l.items[key].Value.(*listItem)) {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// Adds the item to the value index
+func (l *LRUCache) indexValue(item *listItem) {
+	if l.valueKey == nil {
+		return
+	}
+
+	valueKey := l.valueKey(item.value)
+	keys, exist := l.valueIndex[valueKey]
+	if !exist {
+		keys = make(keySet)
+		l.valueIndex[valueKey] = keys
+	}
+	keys[item.key] = struct{}{}
+}
+
+// Removes the item from the value index
+func (l *LRUCache) unindexValue(item *listItem) {
+	if l.valueKey == nil {
+		return
+	}
+
+	valueKey := l.valueKey(item.value)
+	keys := l.valueIndex[valueKey]
+	delete(keys, item.key)
+	if len(keys) == 0 {
+		delete(l.valueIndex, valueKey)
+	}
+}
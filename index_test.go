@@ -0,0 +1,91 @@
+package lrucache
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWithValueIndex(t *testing.T) {
+	resource := func(value any) string {
+		s, _ := value.(string)
+		return s
+	}
+
+	t.Run("lookup", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 5
+		cache, _ := New(cap, WithValueIndex(resource))
+		cache.Set("b", "r1")
+		cache.Set("a", "r1")
+		cache.Set("c", "r2")
+
+		if got, want := cache.KeysByValue("r1"), []Key{"a", "b"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("got = %v, want = %v", got, want)
+		}
+		if got := cache.KeysByValue("missing"); got != nil {
+			t.Errorf("got = %v, want = <nil>", got)
+		}
+	})
+
+	t.Run("updates", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 5
+		cache, _ := New(cap, WithValueIndex(resource))
+		cache.Set("a", "r1")
+		cache.Set("b", "r1")
+		cache.Set("a", "r2")
+		cache.Update("b", "r2")
+
+		if got := cache.KeysByValue("r1"); got != nil {
+			t.Errorf("got = %v, want = <nil>", got)
+		}
+		if got, want := cache.KeysByValue("r2"), []Key{"a", "b"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("got = %v, want = %v", got, want)
+		}
+		if got := len(cache.valueIndex); got != 1 {
+			t.Errorf("empty value keys must be dropped: got = %v, want = %v", got, 1)
+		}
+	})
+
+	t.Run("evictions", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap = 2
+			ttl = time.Minute
+		)
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		cache, _ := New(cap, WithNowFunc(func() time.Time { return now }), WithValueIndex(resource))
+		cache.Set("a", "r1")
+		cache.Set("b", "r1")
+		cache.Set("c", "r1")
+
+		if got, want := cache.KeysByValue("r1"), []Key{"b", "c"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("got = %v, want = %v", got, want)
+		}
+
+		cache.Delete("b")
+		cache.SetWithExpiry("d", "r1", now.Add(ttl))
+		now = now.Add(ttl)
+		if got, want := cache.KeysByValue("r1"), []Key{"c"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("expired element must be skipped: got = %v, want = %v", got, want)
+		}
+
+		cache.Purge()
+		if got := len(cache.valueIndex); got != 0 {
+			t.Errorf("got index size = %v, want = %v", got, 0)
+		}
+	})
+
+	t.Run("nil function", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 5
+		if _, err := New(cap, WithValueIndex(nil)); err == nil {
+			t.Error("got = <nil>, want error")
+		}
+	})
+}
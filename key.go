@@ -0,0 +1,31 @@
+package lrucache
+
+import "strconv"
+
+// Key constructors for non-string keys. Every constructor is deterministic and injective,
+// and prefixes the encoding with its own type tag, so keys built by different constructors
+// never collide (IntKey(1) != BytesKey([]byte("1")) != StringKey("1")).
+// Plain Key conversion isn't tagged: a cache mixing constructors should build string keys by StringKey.
+
+const (
+	intKeyPrefix    = "i:"
+	bytesKeyPrefix  = "b:"
+	stringKeyPrefix = "s:"
+)
+
+// Encodes integer as a key in canonical decimal form after "i:" prefix,
+// strconv.Atoi of the key without the prefix restores the value
+func IntKey(n int) Key {
+	return Key(intKeyPrefix + strconv.Itoa(n))
+}
+
+// Encodes byte slice as a key holding a copy of the bytes after "b:" prefix,
+// []byte of the key without the prefix restores the value
+func BytesKey(b []byte) Key {
+	return Key(bytesKeyPrefix + string(b))
+}
+
+// Encodes string as a key after "s:" prefix, so it doesn't collide with IntKey and BytesKey keys
+func StringKey(s string) Key {
+	return Key(stringKeyPrefix + s)
+}
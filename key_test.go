@@ -0,0 +1,138 @@
+package lrucache
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestIntKey(t *testing.T) {
+	t.Run("distinct keys", func(t *testing.T) {
+		t.Parallel()
+
+		inputs := []int{0, 1, -1, 10, -10, math.MaxInt, math.MinInt}
+		keys := make(map[Key]int, len(inputs))
+		for _, n := range inputs {
+			key := IntKey(n)
+			if prev, ok := keys[key]; ok {
+				t.Errorf("collision: %v and %v give key %q", prev, n, key)
+			}
+			keys[key] = n
+		}
+	})
+
+	t.Run("round trip", func(t *testing.T) {
+		t.Parallel()
+
+		for _, want := range []int{0, 42, -42, math.MaxInt, math.MinInt} {
+			got, err := strconv.Atoi(strings.TrimPrefix(string(IntKey(want)), intKeyPrefix))
+			if err != nil || got != want {
+				t.Errorf("got = %v %v, want = %v", got, err, want)
+			}
+		}
+	})
+
+	t.Run("cache usage", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 2
+		cache, _ := New(cap)
+		cache.Set(IntKey(1), "one")
+
+		if got, ok := cache.Get(IntKey(1)); !ok || got != "one" {
+			t.Errorf("got = %v, want = %v", got, "one")
+		}
+	})
+}
+
+func TestBytesKey(t *testing.T) {
+	t.Run("distinct keys", func(t *testing.T) {
+		t.Parallel()
+
+		inputs := [][]byte{nil, {0}, {0, 0}, {1}, {0, 1}, {1, 0}, []byte("key")}
+		keys := make(map[Key][]byte, len(inputs))
+		for _, b := range inputs {
+			key := BytesKey(b)
+			if prev, ok := keys[key]; ok {
+				t.Errorf("collision: %v and %v give key %q", prev, b, key)
+			}
+			keys[key] = b
+		}
+	})
+
+	t.Run("round trip", func(t *testing.T) {
+		t.Parallel()
+
+		want := []byte{0, 1, 0xff, 'k'}
+		if got := []byte(strings.TrimPrefix(string(BytesKey(want)), bytesKeyPrefix)); !bytes.Equal(got, want) {
+			t.Errorf("got = %v, want = %v", got, want)
+		}
+	})
+
+	t.Run("key is a copy", func(t *testing.T) {
+		t.Parallel()
+
+		b := []byte("key")
+		key := BytesKey(b)
+		b[0] = 'x'
+
+		if key != BytesKey([]byte("key")) {
+			t.Errorf("got = %q, want = %q", key, BytesKey([]byte("key")))
+		}
+	})
+}
+
+func TestKeyConstructors(t *testing.T) {
+	t.Run("no collisions between constructors", func(t *testing.T) {
+		t.Parallel()
+
+		inputs := []struct {
+			name string
+			key  Key
+		}{
+			{"IntKey(1)", IntKey(1)},
+			{"BytesKey(1)", BytesKey([]byte("1"))},
+			{"StringKey(1)", StringKey("1")},
+			{"IntKey(-1)", IntKey(-1)},
+			{"BytesKey(-1)", BytesKey([]byte("-1"))},
+			{"StringKey(-1)", StringKey("-1")},
+			{"BytesKey(i:1)", BytesKey([]byte("i:1"))},
+			{"StringKey(b:1)", StringKey("b:1")},
+			{"BytesKey(nil)", BytesKey(nil)},
+			{"StringKey()", StringKey("")},
+		}
+
+		keys := make(map[Key]string, len(inputs))
+		for _, in := range inputs {
+			if prev, ok := keys[in.key]; ok {
+				t.Errorf("collision: %v and %v give key %q", prev, in.name, in.key)
+			}
+			keys[in.key] = in.name
+		}
+	})
+
+	t.Run("cache usage", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 3
+		cache, _ := New(cap)
+		cache.Set(IntKey(1), "int")
+		cache.Set(BytesKey([]byte("1")), "bytes")
+		cache.Set(StringKey("1"), "string")
+
+		if got := cache.Len(); got != cap {
+			t.Errorf("got = %v, want = %v", got, cap)
+		}
+		if got, _ := cache.Get(IntKey(1)); got != "int" {
+			t.Errorf("got = %v, want = %v", got, "int")
+		}
+		if got, _ := cache.Get(BytesKey([]byte("1"))); got != "bytes" {
+			t.Errorf("got = %v, want = %v", got, "bytes")
+		}
+		if got, _ := cache.Get(StringKey("1")); got != "string" {
+			t.Errorf("got = %v, want = %v", got, "string")
+		}
+	})
+}
@@ -0,0 +1,61 @@
+package lrucache
+
+import "sync"
+
+// Number of key lock stripes, see WithKeyLocks
+const keyLockStripes = 256
+
+// Striped per-key mutexes: a key always maps to the same mutex
+type keyMutexes [keyLockStripes]sync.Mutex
+
+// Locks the mutex of the key
+func (m *keyMutexes) lock(key Key) *sync.Mutex {
+	mu := &m[fnvHash(key)%keyLockStripes]
+	mu.Lock()
+	return mu
+}
+
+// Sets per-key locking option for the write path of WithWriteThrough: Set and SetThrough
+// update the cache under a short cache lock and call the store under a lock of the key,
+// so writes of distinct keys reach a slow store concurrently instead of serializing on the cache lock.
+// The store sees writes of the same key in order, writes of distinct keys in any order.
+// Keys are spread over keyLockStripes mutexes, so distinct keys may occasionally share one.
+// Readers may see a value before the store has accepted it, SetThrough still rolls back a failed
+// write unless the element was deleted or replaced meanwhile. Without WithWriteThrough the option has no effect.
+func WithKeyLocks() Option {
+	return func(l *LRUCache) error {
+		l.keyLocks = new(keyMutexes)
+		return nil
+	}
+}
+
+// Adds value to cache and writes it through to the store, see set.
+// With key locks the store is called outside the cache lock under the key lock,
+// eviction callbacks run after the key lock is released, so they may write keys of the same stripe.
+func (l *LRUCache) write(key Key, value any, rollback bool) (bool, error) {
+	if l.keyLocks == nil || l.writeThrough == nil {
+		l.lock()
+		defer l.unlock()
+
+		return l.set(key, value, rollback)
+	}
+
+	mu := l.keyLocks.lock(key)
+	l.lock()
+	node, updated, old, stored := l.put(key, value)
+	pending := l.detach()
+
+	var err error
+	if stored {
+		err = l.writeThrough(key, value)
+	}
+	if err != nil && rollback {
+		l.lock()
+		l.restore(key, node, updated, old)
+		pending = append(pending, l.detach()...)
+	}
+
+	mu.Unlock()
+	l.flush(pending)
+	return updated, err
+}
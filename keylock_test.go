@@ -0,0 +1,194 @@
+package lrucache
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWithKeyLocks(t *testing.T) {
+	t.Run("distinct hot keys", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap        = 64
+			goroutines = 16
+			keys       = 4
+			ops        = 500
+		)
+		var mu sync.Mutex
+		store := make(map[Key]any)
+		cache, _ := New(cap, WithKeyLocks(), WithWriteThrough(func(key Key, value any) error {
+			mu.Lock()
+			defer mu.Unlock()
+			store[key] = value
+			return nil
+		}))
+
+		var wg sync.WaitGroup
+		for g := range goroutines {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range ops {
+					key := Key(strconv.Itoa(g*keys + i%keys))
+					if _, err := cache.SetThrough(key, i); err != nil {
+						t.Errorf("not expected error = %v", err)
+						return
+					}
+					if got, ok := cache.Get(key); !ok || got != i {
+						t.Errorf("own key update lost: got = %v, want = %v", got, i)
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		for key, value := range store {
+			if got, _ := cache.Peek(key); got != value {
+				t.Errorf("store is out of sync for %v: got = %v, want = %v", key, value, got)
+			}
+		}
+		if err := cache.Validate(); err != nil {
+			t.Errorf("not expected error = %v", err)
+		}
+	})
+
+	t.Run("store runs outside cache lock", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap     = 4
+			timeout = time.Second
+		)
+		started, release := make(chan struct{}), make(chan struct{})
+		cache, _ := New(cap, WithKeyLocks(), WithWriteThrough(func(key Key, _ any) error {
+			if key == "slow" {
+				close(started)
+				<-release
+			}
+			return nil
+		}))
+
+		go cache.Set("slow", 1)
+		<-started
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			cache.Set("fast", 2)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(timeout):
+			t.Error("write of a distinct key must not wait for the slow store")
+		}
+		close(release)
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 4
+		failure := errors.New("store is down")
+		var fail atomic.Bool
+		cache, _ := New(cap, WithKeyLocks(), WithWriteThrough(func(Key, any) error {
+			if fail.Load() {
+				return failure
+			}
+			return nil
+		}))
+		cache.Set("one", 1)
+		fail.Store(true)
+
+		if _, err := cache.SetThrough("one", 2); !errors.Is(err, failure) {
+			t.Errorf("got = %v, want = %v", err, failure)
+		}
+		if got, _ := cache.Peek("one"); got != 1 {
+			t.Errorf("update must be rolled back: got = %v, want = %v", got, 1)
+		}
+
+		if _, err := cache.SetThrough("two", 2); !errors.Is(err, failure) || cache.Contains("two") {
+			t.Errorf("insert must be rolled back: got = %v", err)
+		}
+	})
+
+	t.Run("callback writes key of the same stripe", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap     = 1
+			evicted = Key("one")
+			timeout = time.Second
+		)
+		stripe := func(key Key) uint64 { return fnvHash(key) % keyLockStripes }
+		key := Key("0")
+		for i := 1; stripe(key) != stripe("log:"+evicted); i++ {
+			key = Key(strconv.Itoa(i))
+		}
+
+		var cache *LRUCache
+		cache, _ = New(cap, WithKeyLocks(), WithWriteThrough(func(Key, any) error { return nil }),
+			WithOnEvict(func(key Key, value any, _ EvictReason) {
+				if !strings.HasPrefix(string(key), "log:") {
+					cache.Set("log:"+key, value)
+				}
+			}))
+		cache.Set(evicted, 1)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			cache.Set(key, 2)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(timeout):
+			t.Fatal("callback writing a key of the same stripe deadlocked")
+		}
+	})
+}
+
+func BenchmarkSetThroughParallel(b *testing.B) {
+	const (
+		cap     = 1024
+		latency = 10 * time.Microsecond
+	)
+
+	cases := []struct {
+		name    string
+		options []Option
+	}{
+		{"cache lock", nil},
+		{"key locks", []Option{WithKeyLocks()}},
+	}
+
+	for _, tt := range cases {
+		b.Run(tt.name, func(b *testing.B) {
+			store := WithWriteThrough(func(Key, any) error {
+				time.Sleep(latency)
+				return nil
+			})
+			cache, _ := New(cap, append(tt.options, store)...)
+
+			var next atomic.Int64
+			b.SetParallelism(8)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				key := Key(strconv.FormatInt(next.Add(1), 10))
+				i := 0
+				for pb.Next() {
+					cache.Set(key, i)
+					i++
+				}
+			})
+		})
+	}
+}
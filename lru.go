@@ -1,10 +1,20 @@
 package lrucache
 
 import (
+	"container/heap"
 	"container/list"
 	"context"
 	"errors"
+	"fmt"
+	"iter"
+	"maps"
+	"math"
+	"math/rand"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -12,34 +22,231 @@ type (
 	Key         string
 	Option      func(*LRUCache) error
 	cleanerFunc func(*LRUCache)
+	EvictFunc   func(key Key, value any, reason EvictReason)
 )
 
+// Reason of element eviction
+type EvictReason int
+
+const (
+	EvictCapacity EvictReason = iota // evicted to free space for a new element
+	EvictExpired                     // removed after ttl
+	EvictManual                      // removed by ForceEvict
+)
+
+// Eviction policy
+type Policy int
+
+const (
+	PolicyLRU    Policy = iota // evicts the least recently used element
+	PolicyLFU                  // evicts the least frequently used element, ties are broken by recency
+	Policy2Q                   // admits new elements to the probationary queue, promotes them to the main queue on the second access
+	PolicyFIFO                 // evicts elements in insertion order, access doesn't affect the order
+	PolicyRandom               // evicts a uniformly chosen random element
+)
+
+// Cache safe for concurrent use. All operations are serialized by a single mutex:
+// even a read of a distinct key reorders the shared recency queue. Use ShardedCache
+// to scale writes and WithKeyLocks to take slow write-through stores out of the mutex.
 type LRUCache struct {
-	cap    int           // cache capacity
-	ttl    time.Duration // ttl
-	cancel context.CancelFunc
-	cf     cleanerFunc
-	mu     sync.Mutex
-	items  map[Key]*list.Element // hash table
-	queue  *list.List            // order list
+	cap               int           // cache capacity
+	ttl               time.Duration // ttl
+	policy            Policy        // eviction policy
+	cancel            context.CancelFunc
+	done              chan struct{}      // closed when the cleaner exits
+	cleanerMu         sync.Mutex         // guards starting and stopping the cleaner
+	cleanInterval     time.Duration      // cleaner check interval, 0 - no cleaner is configured
+	cleanerPaused     atomic.Bool        // the cleaner skips sweeps
+	autoClean         bool               // the cleaner starts with the cache (WithTTL)
+	resolution        time.Duration      // min interval between adaptive cleaner runs, 0 - the cleaner runs on a fixed tick
+	wake              chan struct{}      // wakes the adaptive cleaner when an earlier expiration appears
+	wakeAt            time.Time          // next adaptive cleaner run, zero - the cleaner waits for wake
+	hookCancel        context.CancelFunc // stops memory pressure hook
+	pressure          <-chan struct{}    // memory pressure signals, see WithMemoryPressureHook
+	shrinkBy          float64            // fraction of elements evicted on memory pressure
+	cf                cleanerFunc
+	mu                sync.Mutex
+	items             map[Key]*list.Element // hash table
+	queue             *list.List            // order list
+	evictor           evictionPolicy        // eviction policy implementation
+	expiry            expiryHeap            // expiring elements ordered by expiration time
+	rnd               *rand.Rand            // random source (random policy)
+	randSrc           rand.Source           // source set by WithRandSource, shared by every copy of the option
+	now               func() time.Time      // current time source
+	missBase          time.Duration         // initial tombstone ttl
+	missMax           time.Duration         // max tombstone ttl
+	negativeTTL       time.Duration         // SetMiss tombstone ttl, 0 - the default ttl
+	source            Source                // read-through source
+	writeThrough      func(Key, any) error  // write-through store, nil - writes stay in memory
+	keyLocks          *keyMutexes           // per-key write-through locks, nil - stores run under the cache lock
+	loads             flightGroup           // in-flight source loads
+	loadSlots         chan struct{}         // limits concurrent loads
+	refreshAhead      time.Duration         // reads reload elements expiring within it, 0 - refresh-ahead is disabled
+	batchSize         int                   // max expired items cleared per lock acquisition, 0 - unlimited
+	clearOnClose      bool                  // Close removes data
+	noRefreshOnUpdate bool                  // updates don't refresh ttl
+	refreshThrottle   time.Duration         // min time between ttl refreshes on read, 0 - every read refreshes
+	valueEquals       func(a, b any) bool   // detects no-op updates, nil - every update is a change
+	valueKey          func(any) string      // derives value index keys, nil - value index is disabled
+	valueIndex        map[string]keySet     // cache keys by value key, see WithValueIndex
+	cost              int64                 // total cost of elements
+	maxCost           int64                 // max total cost, 0 - cost isn't limited
+	estimateCost      bool                  // element cost is estimated from its size, see WithMaxBytes
+	maxAge            time.Duration         // max element lifetime, 0 - lifetime isn't limited
+	maxKeyLen         int                   // max key length in bytes, 0 - key length isn't limited
+	rejectEmptyKeys   bool                  // empty keys are rejected
+	rejectNilValues   bool                  // Set with nil value deletes the element
+	initial           map[Key]any           // entries added at construction
+	onEvict           EvictFunc             // eviction callback
+	onExpire          func(Key, any)        // expiration callback
+	onPanic           func(any)             // recovered callback panic handler
+	pending           []evicted             // evicted elements waiting for the callback
+	setResult         *SetResult            // collects capacity evictions of the running SetWithResult
+	callbacks         chan evicted          // async callback queue, nil - callbacks are synchronous
+	workers           int                   // number of async callback workers
+	callbacksMu       sync.RWMutex          // guards sending to the async callback queue against closing it
+	callbacksClosed   bool                  // async callback queue is closed
+	callbackWorkers   sync.WaitGroup        // running async callback workers
+	droppedCallbacks  atomic.Int64          // callbacks dropped because the async queue was full
+	callbackTimeout   time.Duration         // max callback wait, 0 - callbacks aren't limited
+	abandoned         atomic.Int64          // callbacks abandoned after the timeout
+	maxUsed           int                   // max number of elements ever stored
+	lowWatermark      float64               // fraction of capacity kept after eviction, 0 - one element is evicted
+	slack             int                   // number of elements allowed over capacity before eviction
+	loadFactor        float64               // fraction of capacity starting eviction, 0 - eviction starts at capacity
+	minSize           int                   // memory pressure shrink floor
+	lockProfiling     bool                  // lock wait time is recorded
+	lockWaitAvg       time.Duration         // rolling average lock wait time
+	lockWaitMax       time.Duration         // max lock wait time
+	hits              int64                 // number of read hits
+	misses            int64                 // number of read misses
+	minHitRatio       float64               // auto tuning hit ratio threshold
+	maxCap            int                   // auto tuning capacity limit
+	tuneWindow        int                   // number of reads between auto tuning checks, 0 - auto tuning is disabled
+	windowReads       int                   // reads in the current auto tuning window
+	windowHits        int                   // hits in the current auto tuning window
+}
+
+// Cache statistics
+type Stats struct {
+	Hits        int64         // number of read hits
+	Misses      int64         // number of read misses
+	MaxUsed     int           // max number of elements ever stored
+	LockWaitAvg time.Duration // rolling average lock wait time, set with WithLockProfiling
+	LockWaitMax time.Duration // max lock wait time, set with WithLockProfiling
+	Dropped     int64         // callbacks dropped because the async queue was full, see WithAsyncCallbacks
+	Abandoned   int64         // callbacks abandoned after the timeout, see WithCallbackTimeout
+	Size        int           // number of stored elements
+	Capacity    int           // max number of elements
+	Utilization float64       // Size / Capacity
+}
+
+// Weight of the lock wait moving average: each wait contributes 1/lockWaitWeight
+const lockWaitWeight = 16
+
+// Cache element
+type Entry struct {
+	Key       Key
+	Value     any
+	ExpiresAt time.Time // zero if the element doesn't expire
+}
+
+// Result of a key lookup
+type Result struct {
+	Key   Key
+	Value any
+	Found bool
+}
+
+// Effect of a read on the element expiration, reported by GetInfo
+type AccessInfo struct {
+	Extended  bool      // sliding ttl was extended by the access
+	Absolute  bool      // expiration time is fixed, access doesn't extend it
+	ExpiresAt time.Time // expiration time after the access, zero time means no expiration
+}
+
+// Result of SetWithResult
+type SetResult struct {
+	Updated      bool // existing element was updated
+	Inserted     bool // new element was added
+	Evicted      bool // elements were evicted to free space for the new one
+	EvictedKey   Key  // key of the first evicted element
+	EvictedCount int  // number of evicted elements, more than one with WithEvictionLowWatermark or max cost
+}
+
+type evicted struct {
+	key    Key
+	value  any
+	reason EvictReason
 }
 
 type listItem struct {
-	key       Key
-	value     any
-	expiresAt time.Time
+	key        Key
+	value      any
+	expiresAt  time.Time
+	freq       uint64        // number of accesses, accessed atomically
+	probation  bool          // element is in the probationary queue (2Q policy)
+	slot       int           // element index in the random policy nodes
+	bucket     *list.Element // frequency bucket of the element (LFU policy)
+	bucketNode *list.Element // element position in its frequency bucket (LFU) or in its queue (2Q policy)
+	cost       int64         // element cost
+	insertedAt time.Time     // time the element was added, updates don't change it
+	updatedAt  time.Time     // time the value was last set
+	absolute   bool          // expiresAt is fixed, access doesn't refresh it
+	ttl        time.Duration // element own ttl overriding the default one
+	touchedAt  time.Time     // time the sliding ttl was last refreshed
+	heapIdx    int           // index in the expiry heap
+	meta       any           // opaque metadata
 }
 
+// Recycles items of deleted elements to reduce allocations on high-churn caches
+var itemPool = sync.Pool{New: func() any { return new(listItem) }}
+
+type tombstone struct{}
+
+// Value stored for negatively cached keys: Get returns Miss and true
+// when the key is known to be missing in the backing store
+var Miss any = tombstone{}
+
+var (
+	ErrNotFound    = errors.New("element doesn't exist")
+	ErrExpired     = errors.New("element has expired")
+	ErrKeyRejected = errors.New("key is rejected")
+)
+
+// Default cache capacity used by NewWithOptions
+const DefaultCapacity = 1024
+
+// Max number of preallocated hash table entries, a bigger table grows on demand
+const maxPrealloc = 1 << 16
+
+// Max number of keys shown by String
+const maxStringKeys = 10
+
 // Creates new LRUCache
 func New(cap int, options ...Option) (*LRUCache, error) {
-	if cap <= 0 {
-		return nil, errors.New("cap must be positive")
+	return NewWithOptions(append([]Option{WithCapacity(cap)}, options...)...)
+}
+
+// Creates new LRUCache configured only by options.
+// Capacity is DefaultCapacity unless WithCapacity is passed.
+func NewWithOptions(options ...Option) (*LRUCache, error) {
+	lruCache, err := configure(options)
+	if err != nil {
+		return nil, err
 	}
+
+	lruCache.start()
+	return lruCache, nil
+}
+
+// Creates new LRUCache applying options, background work isn't started yet
+func configure(options []Option) (*LRUCache, error) {
 	lruCache := &LRUCache{
-		cap:   cap,
-		items: make(map[Key]*list.Element, cap),
+		cap:   DefaultCapacity,
 		queue: list.New(),
 		cf:    clearExpired,
+		now:   time.Now,
 	}
 
 	for _, opt := range options {
@@ -47,125 +254,1973 @@ func New(cap int, options ...Option) (*LRUCache, error) {
 			return nil, err
 		}
 	}
+
+	lruCache.items = make(map[Key]*list.Element, min(lruCache.cap, maxPrealloc))
+	lruCache.evictor = newEvictionPolicy(lruCache)
 	return lruCache, nil
 }
 
-// Sets time-to-live option.
-// Ticks (must be greater 1) - the number of checks for expired elements during the ttl period.
-func WithTTL(ttl time.Duration, ticks int) Option {
+// Starts the cleaner, memory pressure hook and async callback workers, adds initial entries
+func (l *LRUCache) start() {
+	if l.autoClean {
+		l.runCleaner()
+	}
+	l.startMemoryPressureHook()
+	l.startCallbackWorkers()
+	for key, value := range l.initial {
+		l.Set(key, value)
+	}
+	l.initial = nil
+}
+
+// Sets cache capacity option
+func WithCapacity(cap int) Option {
 	return func(l *LRUCache) error {
-		if ttl <= 0 {
-			return errors.New("ttl duration must be positive")
+		if cap <= 0 {
+			return errors.New("cap must be positive")
 		}
 
-		if ticks <= 1 {
-			return errors.New("ticks must be greater 1")
+		l.cap = cap
+		return nil
+	}
+}
+
+// Sets eviction policy option. PolicyLRU is used by default.
+func WithEvictionPolicy(policy Policy) Option {
+	return func(l *LRUCache) error {
+		switch policy {
+		case PolicyLRU, PolicyLFU, Policy2Q, PolicyFIFO, PolicyRandom:
+		default:
+			return errors.New("unknown eviction policy")
 		}
 
-		l.ttl = ttl
+		l.policy = policy
+		return nil
+	}
+}
 
-		ctx, cancel := context.WithCancel(context.Background())
-		l.cancel = cancel
+// Sets current time source option used for ttl calculations. time.Now is used by default.
+func WithNowFunc(now func() time.Time) Option {
+	return func(l *LRUCache) error {
+		if now == nil {
+			return errors.New("now function must not be nil")
+		}
 
-		go func() {
+		l.now = now
+		return nil
+	}
+}
 
-			ticker := time.NewTicker(l.ttl / time.Duration(ticks))
-			defer ticker.Stop()
+// Sets random source option used by PolicyRandom.
+// Source is seeded with the current time by default.
+func WithRandSource(src rand.Source) Option {
+	return func(l *LRUCache) error {
+		if src == nil {
+			return errors.New("random source must not be nil")
+		}
 
-			for {
-				select {
-				case <-ctx.Done():
-					return
-				case <-ticker.C:
-					l.cf(l)
-				}
-			}
-		}()
+		l.rnd = rand.New(src)
+		l.randSrc = src
+		return nil
+	}
+}
 
+// Sets max total cost option.
+// Elements added by SetWithCost are evicted until their total cost fits maxCost.
+func WithMaxCost(maxCost int64) Option {
+	return func(l *LRUCache) error {
+		if maxCost <= 0 {
+			return errors.New("max cost must be positive")
+		}
+
+		l.maxCost = maxCost
 		return nil
 	}
 }
 
-// Adds value to cache.
-// Return: true - existing element was updated, false - new element was added
-func (l *LRUCache) Set(key Key, value any) bool {
+// Sets max age option.
+// Caps sliding ttl extension, so an element expires after maxAge since insertion regardless of access.
+// Takes effect together with WithTTL.
+func WithMaxAge(maxAge time.Duration) Option {
+	return func(l *LRUCache) error {
+		if maxAge <= 0 {
+			return errors.New("max age must be positive")
+		}
 
-	newItem := &listItem{key: key, value: value}
-	if l.ttl > 0 {
-		newItem.expiresAt = time.Now().Add(l.ttl)
+		l.maxAge = maxAge
+		return nil
 	}
+}
 
-	l.mu.Lock()
-	defer l.mu.Unlock()
+// Sets eviction low watermark option: when capacity is hit the cache evicts elements
+// down to fraction * cap in one pass instead of one element per insert. Batches amortize
+// eviction under steady churn at the cost of a latency spike on the evicting insert and
+// a lower average fill, so fewer elements are cached. Callbacks fire for each evicted element.
+func WithEvictionLowWatermark(fraction float64) Option {
+	return func(l *LRUCache) error {
+		if fraction <= 0 || fraction >= 1 {
+			return errors.New("low watermark must be in (0, 1)")
+		}
 
-	if node, exist := l.items[key]; exist {
-		node.Value = newItem
-		l.queue.MoveToFront(node)
-		return true
+		l.lowWatermark = fraction
+		return nil
 	}
+}
+
+// Sets eviction slack option: the cache grows up to cap + slack elements without eviction,
+// the insert which exceeds it trims the cache back to capacity in one pass.
+// Bursts of inserts do less eviction work at the cost of temporary over-capacity memory use.
+func WithEvictionSlack(slack int) Option {
+	return func(l *LRUCache) error {
+		if slack <= 0 {
+			return errors.New("eviction slack must be positive")
+		}
 
-	if len(l.items) == l.cap {
-		l.deleteItem(l.queue.Back())
+		l.slack = slack
+		return nil
 	}
+}
 
-	l.items[key] = l.queue.PushFront(newItem)
-	return false
+// Sets load factor option: eviction starts when the number of elements reaches int(f * cap)
+// instead of cap, so the cache keeps cap - int(f * cap) free slots as headroom for bursts.
+// cap stays the absolute ceiling and is reported by Stats, IsFull and auto tuning treat the cache
+// as full at the load factor. At least one element is always kept. Takes precedence over WithEvictionSlack.
+func WithLoadFactor(f float64) Option {
+	return func(l *LRUCache) error {
+		if f <= 0 || f > 1 {
+			return errors.New("load factor must be in (0, 1]")
+		}
+
+		l.loadFactor = f
+		return nil
+	}
 }
 
-// Gets value from cache
-// Return: true - element exists, false - element doesn't exist
-func (l *LRUCache) Get(key Key) (any, bool) {
-	l.mu.Lock()
-	defer l.mu.Unlock()
+// Sets initial entries option: the entries are added by Set after all options are applied,
+// so capacity, ttl and key checks apply to them. Map order is random: if entries exceed capacity,
+// cap of them survive in unspecified order. Use Warm to seed the cache in a given order.
+func WithInitialEntries(entries map[Key]any) Option {
+	return func(l *LRUCache) error {
+		l.initial = entries
+		return nil
+	}
+}
 
-	node, exist := l.items[key]
-	if !exist {
-		return nil, false
+// Sets eviction callback option.
+// The callback is called for every evicted or expired element after the cache lock is released,
+// so it may safely call cache methods. Delete and Clear don't trigger the callback.
+func WithOnEvict(fn EvictFunc) Option {
+	return func(l *LRUCache) error {
+		if fn == nil {
+			return errors.New("eviction callback must not be nil")
+		}
+
+		l.onEvict = fn
+		return nil
 	}
+}
+
+// Sets expiration callback option.
+// The callback is called exactly once for every element removed by the cleaner or DeleteExpired.
+// Elements are removed under the cache lock, the callback is called after the lock is released,
+// so it may safely call cache methods.
+func WithOnExpire(fn func(key Key, value any)) Option {
+	return func(l *LRUCache) error {
+		if fn == nil {
+			return errors.New("expiration callback must not be nil")
+		}
 
-	li := node.Value.(*listItem)
-	if l.ttl > 0 {
-		li.expiresAt = time.Now().Add(l.ttl)
+		l.onExpire = fn
+		return nil
 	}
-	l.queue.MoveToFront(node)
-	return li.value, true
 }
 
-// Clears cache, cancels ttl checks
-func (l *LRUCache) Clear() {
-	if l.cancel != nil {
-		l.cancel()
-		l.ttl = 0
+// Sets negative caching backoff option used by SetMissWithBackoff.
+// Tombstone ttl starts from base and doubles on every confirmed miss up to max.
+func WithMissBackoff(base, max time.Duration) Option {
+	return func(l *LRUCache) error {
+		if base <= 0 {
+			return errors.New("miss backoff base must be positive")
+		}
+
+		if max < base {
+			return errors.New("miss backoff max must not be less than base")
+		}
+
+		l.missBase = base
+		l.missMax = max
+		return nil
 	}
+}
 
-	clear(l.items)
-	l.queue.Init()
+// Sets negative ttl option used by SetMiss: tombstones expire after ttl independently
+// of the default ttl of values, so missing keys are retried sooner than present values.
+func WithNegativeTTL(ttl time.Duration) Option {
+	return func(l *LRUCache) error {
+		if ttl <= 0 {
+			return errors.New("negative ttl must be positive")
+		}
+
+		l.negativeTTL = ttl
+		return nil
+	}
 }
 
-// Clears expired cache items
-func clearExpired(l *LRUCache) {
-	l.mu.Lock()
-	defer l.mu.Unlock()
+// Sets cleanup batch size option.
+// The cleaner clears at most n expired elements per lock acquisition and releases the lock
+// between batches, so concurrent callers aren't stalled by a big sweep at the cost of
+// a slightly delayed full cleanup.
+func WithCleanupBatchSize(n int) Option {
+	return func(l *LRUCache) error {
+		if n <= 0 {
+			return errors.New("cleanup batch size must be positive")
+		}
+
+		l.batchSize = n
+		return nil
+	}
+}
+
+// Sets clear on close option. If enabled, Close removes all elements after stopping the cleaner.
+func WithClearOnClose(enabled bool) Option {
+	return func(l *LRUCache) error {
+		l.clearOnClose = enabled
+		return nil
+	}
+}
+
+// Sets max key length option, protects from huge keys derived from untrusted input.
+// Keys longer than maxKeyLen bytes are rejected: methods adding elements silently
+// don't add them and return the same result as for an absent element, Set returns false.
+func WithMaxKeyLen(maxKeyLen int) Option {
+	return func(l *LRUCache) error {
+		if maxKeyLen <= 0 {
+			return errors.New("max key length must be positive")
+		}
+
+		l.maxKeyLen = maxKeyLen
+		return nil
+	}
+}
+
+// Sets reject empty keys option, guards against caching under a key which wasn't computed.
+// Empty key is rejected like a too long one (see WithMaxKeyLen): it's never added and Get misses it.
+func WithRejectEmptyKeys() Option {
+	return func(l *LRUCache) error {
+		l.rejectEmptyKeys = true
+		return nil
+	}
+}
+
+// Sets reject nil values option: every method adding or updating elements with a nil value
+// (Set, Update, Swap, Warm, loaders and others) deletes the element instead of storing nil
+// and reports it like an absent element, so a found element never has nil value.
+// The deletion doesn't run the eviction callback and isn't written through.
+// By default nil is a legal value: Get returns nil and true for it.
+func WithRejectNilValues() Option {
+	return func(l *LRUCache) error {
+		l.rejectNilValues = true
+		return nil
+	}
+}
+
+// Sets panic handler option. Panics of the eviction and expiration callbacks are always recovered,
+// the handler receives the recovered values.
+func WithPanicHandler(fn func(recovered any)) Option {
+	return func(l *LRUCache) error {
+		if fn == nil {
+			return errors.New("panic handler must not be nil")
+		}
+
+		l.onPanic = fn
+		return nil
+	}
+}
+
+// Sets no refresh on update option.
+// Set and Update of an existing element change its value and recency but keep its expiration time:
+// a sliding ttl element is extended only by reads, an absolute deadline element keeps its deadline.
+// Methods with explicit expiration (SetWithExpiry, SetMultiWithTTL etc.) still set it.
+func WithNoRefreshOnUpdate() Option {
+	return func(l *LRUCache) error {
+		l.noRefreshOnUpdate = true
+		return nil
+	}
+}
+
+// Sets refresh throttle option: a read extends the sliding ttl of an element only if at least
+// min has passed since its last refresh, so a tight read loop doesn't rewrite the expiration
+// on every access. Updates and Refresh always refresh ttl.
+func WithRefreshThrottle(min time.Duration) Option {
+	return func(l *LRUCache) error {
+		if min <= 0 {
+			return errors.New("refresh throttle must be positive")
+		}
+
+		l.refreshThrottle = min
+		return nil
+	}
+}
+
+// Sets value equality option used to skip no-op updates: Set and other updates of an existing
+// element with an equal value only promote it, its value, ttl and update time are kept.
+// By default values aren't compared and every update is applied in full.
+func WithValueEquals(equals func(a, b any) bool) Option {
+	return func(l *LRUCache) error {
+		if equals == nil {
+			return errors.New("value equality function must not be nil")
+		}
+
+		l.valueEquals = equals
+		return nil
+	}
+}
+
+// Sets memory pressure hook option.
+// Every signal from ch evicts shrinkBy fraction of current elements in eviction policy order,
+// but not below the floor set by WithMemoryPressureFloor. The hook is stopped by Close.
+func WithMemoryPressureHook(ch <-chan struct{}, shrinkBy float64) Option {
+	return func(l *LRUCache) error {
+		if ch == nil {
+			return errors.New("memory pressure channel must not be nil")
+		}
+
+		if shrinkBy <= 0 || shrinkBy > 1 {
+			return errors.New("shrink fraction must be in (0, 1]")
+		}
+
+		l.pressure = ch
+		l.shrinkBy = shrinkBy
+		return nil
+	}
+}
 
-	if l.queue.Len() == 0 {
+// Starts memory pressure hook if it's configured, see WithMemoryPressureHook
+func (l *LRUCache) startMemoryPressureHook() {
+	if l.pressure == nil {
 		return
 	}
 
-	for node := l.queue.Back(); node != nil; {
-		if expiresAt := node.Value.(*listItem).expiresAt; time.Until(expiresAt) > 0 {
-			return
+	ctx, cancel := context.WithCancel(context.Background())
+	l.hookCancel = cancel
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-l.pressure:
+				l.shrink(l.shrinkBy)
+			}
 		}
+	}()
+}
 
-		delNode := node
-		node = node.Prev()
-		l.deleteItem(delNode)
+// Sets the min number of elements kept by memory pressure shrinking
+func WithMemoryPressureFloor(floor int) Option {
+	return func(l *LRUCache) error {
+		if floor < 0 {
+			return errors.New("memory pressure floor must not be negative")
+		}
 
+		l.minSize = floor
+		return nil
 	}
 }
 
-// Deletes node from the queue and the hashtable
-func (l *LRUCache) deleteItem(node *list.Element) {
-	l.queue.Remove(node)
-	item := node.Value.(*listItem)
-	delete(l.items, item.key)
+// Sets lock profiling option. Lock wait times of cache operations are measured
+// and reported by Stats as rolling average and max. Disabled by default to avoid the overhead.
+func WithLockProfiling() Option {
+	return func(l *LRUCache) error {
+		l.lockProfiling = true
+		return nil
+	}
+}
+
+// Sets capacity auto tuning option (experimental).
+// After every window reads the hit ratio of the window is computed, if it's below minHitRatio
+// and the cache is full (at capacity or at the load factor, see WithLoadFactor), capacity is doubled up to maxCap.
+func WithAutoTune(minHitRatio float64, maxCap int, window int) Option {
+	return func(l *LRUCache) error {
+		if minHitRatio <= 0 || minHitRatio > 1 {
+			return errors.New("min hit ratio must be in (0, 1]")
+		}
+
+		if maxCap <= 0 {
+			return errors.New("max cap must be positive")
+		}
+
+		if window <= 0 {
+			return errors.New("auto tune window must be positive")
+		}
+
+		l.minHitRatio = minHitRatio
+		l.maxCap = maxCap
+		l.tuneWindow = window
+		return nil
+	}
+}
+
+// Sets time-to-live option.
+// Ticks (must be greater 1) - the number of checks for expired elements during the ttl period.
+func WithTTL(ttl time.Duration, ticks int) Option {
+	return func(l *LRUCache) error {
+		if err := WithTTLPaused(ttl, ticks)(l); err != nil {
+			return err
+		}
+
+		l.autoClean = true
+		return nil
+	}
+}
+
+// Sets time-to-live option like WithTTL, but the cleaner doesn't run until StartCleaner is called.
+// Until then expired elements are deleted lazily on access only.
+func WithTTLPaused(ttl time.Duration, ticks int) Option {
+	return func(l *LRUCache) error {
+		if ttl <= 0 {
+			return errors.New("ttl duration must be positive")
+		}
+
+		if ticks <= 1 {
+			return errors.New("ticks must be greater 1")
+		}
+
+		l.ttl = ttl
+		l.cleanInterval = ttl / time.Duration(ticks)
+		return nil
+	}
+}
+
+// Starts the cleaner configured by WithTTLPaused or restarts the one stopped by Close.
+// Return: error if ttl isn't configured or the cleaner is already running
+func (l *LRUCache) StartCleaner() error {
+	l.cleanerMu.Lock()
+	defer l.cleanerMu.Unlock()
+
+	if l.cleanInterval == 0 {
+		return errors.New("ttl isn't configured")
+	}
+
+	if l.done != nil {
+		select {
+		case <-l.done:
+		default:
+			return errors.New("cleaner is already running")
+		}
+	}
+
+	l.runCleaner()
+	return nil
+}
+
+// Starts the cleaner goroutine
+func (l *LRUCache) runCleaner() {
+	ctx, cancel := context.WithCancel(context.Background())
+	l.cancel = cancel
+	done := make(chan struct{})
+	l.done = done
+
+	if l.resolution > 0 {
+		go func() {
+			defer close(done)
+			l.runAdaptiveCleaner(ctx)
+		}()
+		return
+	}
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(l.cleanInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				l.clean()
+			}
+		}
+	}()
+}
+
+// Runs a cleaner sweep unless the cleaner is paused
+func (l *LRUCache) clean() {
+	if !l.cleanerPaused.Load() {
+		l.cf(l)
+	}
+}
+
+// Pauses expired elements sweeping: the cleaner keeps running but skips sweeps until ResumeCleaner.
+// Expired elements are still deleted lazily on access. Lighter than Close and StartCleaner.
+func (l *LRUCache) PauseCleaner() {
+	l.cleanerPaused.Store(true)
+}
+
+// Resumes expired elements sweeping paused by PauseCleaner from the next cleaner tick
+func (l *LRUCache) ResumeCleaner() {
+	l.cleanerPaused.Store(false)
+}
+
+// Runs the cleaner when the first element expires, but not more often than the resolution
+func (l *LRUCache) runAdaptiveCleaner(ctx context.Context) {
+	for {
+		var (
+			timer *time.Timer
+			fire  <-chan time.Time
+		)
+		if delay, ok := l.nextCleanDelay(); ok {
+			timer = time.NewTimer(delay)
+			fire = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-fire:
+			l.clean()
+		case <-l.wake:
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// Computes the adaptive cleaner delay: time until the first element expires, at least the resolution
+// Return: true - delay is set, false - no element expires, the cleaner waits for wake
+func (l *LRUCache) nextCleanDelay() (time.Duration, bool) {
+	l.lock()
+	defer l.unlock()
+
+	if len(l.expiry) == 0 {
+		l.wakeAt = time.Time{}
+		return 0, false
+	}
+
+	now := l.now()
+	delay := max(l.expiry[0].expiresAt.Sub(now), l.resolution)
+	l.wakeAt = now.Add(delay)
+	return delay, true
+}
+
+// Sets ttl resolution option: instead of polling on a fixed tick the cleaner sleeps until the first
+// element expires, idle cache causes no wakeups. Cleaner runs are at least resolution apart,
+// so elements may stay in cache up to resolution after expiration.
+func WithTTLResolution(resolution time.Duration) Option {
+	return func(l *LRUCache) error {
+		if resolution <= 0 {
+			return errors.New("ttl resolution must be positive")
+		}
+
+		l.resolution = resolution
+		l.wake = make(chan struct{}, 1)
+		return nil
+	}
+}
+
+// Adds value to cache.
+// Return: true - existing element was updated, false - new element was added or nil value was rejected (see WithRejectNilValues)
+func (l *LRUCache) Set(key Key, value any) bool {
+	if l.rejects(key) || l.oversized(key, value) {
+		return false
+	}
+
+	updated, _ := l.write(key, value, false)
+	return updated
+}
+
+// Adds value to cache like Set and reports what happened, including capacity eviction.
+// Rejected keys (see WithMaxKeyLen) give zero result.
+func (l *LRUCache) SetWithResult(key Key, value any) SetResult {
+	if l.rejects(key) || l.oversized(key, value) {
+		return SetResult{}
+	}
+
+	l.lock()
+	defer l.unlock()
+
+	return l.setWithResult(key, value)
+}
+
+// Adds value to cache reporting what happened
+func (l *LRUCache) setWithResult(key Key, value any) SetResult {
+	if l.deletesNil(key, value) {
+		return SetResult{}
+	}
+
+	if node, exist := l.lookup(key); exist {
+		l.promote(node, value)
+		return SetResult{Updated: true}
+	}
+
+	result := SetResult{Inserted: true}
+	l.setResult = &result
+	l.insert(key, value, 0)
+	l.setResult = nil
+	return result
+}
+
+// Adds delta to an integer value atomically, absent element is added with delta as int64 value
+// getting the default ttl. int and int64 values are supported and keep their type.
+// Return: new value and true, 0 and false if the existing value isn't integer or key is rejected, nothing changed
+func (l *LRUCache) Increment(key Key, delta int64) (int64, bool) {
+	if l.rejects(key) || l.oversized(key, delta) {
+		return 0, false
+	}
+
+	l.lock()
+	defer l.unlock()
+
+	node, exist := l.lookup(key)
+	if !exist {
+		l.insert(key, delta, 0)
+		return delta, true
+	}
+
+	switch value := node.Value.(*listItem).value.(type) {
+	case int64:
+		l.promote(node, value+delta)
+		return value + delta, true
+	case int:
+		l.promote(node, value+int(delta))
+		return int64(value + int(delta)), true
+	default:
+		return 0, false
+	}
+}
+
+// Sets value and returns the previous one atomically, adds the element if it doesn't exist
+// Return: true - existing element was replaced, false - new element was added
+func (l *LRUCache) Swap(key Key, value any) (any, bool) {
+	if l.rejects(key) || l.oversized(key, value) {
+		return nil, false
+	}
+
+	l.lock()
+	defer l.unlock()
+
+	if l.deletesNil(key, value) {
+		return nil, false
+	}
+
+	if node, exist := l.lookup(key); exist {
+		old := node.Value.(*listItem).value
+		l.promote(node, value)
+		return old, true
+	}
+
+	l.insert(key, value, 0)
+	return nil, false
+}
+
+// Adds value with metadata to cache. Metadata is kept by later updates via Set
+// and removed together with the element.
+// Return: true - existing element was updated, false - new element was added
+func (l *LRUCache) SetWithMeta(key Key, value, meta any) bool {
+	if l.rejects(key) || l.oversized(key, value) {
+		return false
+	}
+
+	l.lock()
+	defer l.unlock()
+
+	if l.deletesNil(key, value) {
+		return false
+	}
+
+	if node, exist := l.lookup(key); exist {
+		l.promote(node, value)
+		node.Value.(*listItem).meta = meta
+		return true
+	}
+
+	l.insert(key, value, 0).meta = meta
+	return false
+}
+
+// Gets element metadata without changing its recency and ttl
+// Return: true - element exists, false - element doesn't exist
+func (l *LRUCache) GetMeta(key Key) (any, bool) {
+	l.lock()
+	defer l.unlock()
+
+	node, exist := l.lookup(key)
+	if !exist {
+		return nil, false
+	}
+	return node.Value.(*listItem).meta, true
+}
+
+// Adds value with the given cost to cache. Element cost is counted against max cost,
+// values added by Set have zero cost. Updating an existing element replaces it.
+// Return: true - element was added, false - cost exceeds max cost or key is rejected, nothing changed
+func (l *LRUCache) SetWithCost(key Key, value any, cost int64) bool {
+	if cost < 0 || l.maxCost > 0 && cost > l.maxCost || cost == 0 && l.oversized(key, value) || l.rejects(key) {
+		return false
+	}
+
+	l.lock()
+	defer l.unlock()
+
+	if l.deletesNil(key, value) {
+		return false
+	}
+
+	if node, exist := l.items[key]; exist {
+		l.deleteItem(node)
+	}
+
+	l.insert(key, value, cost)
+	return true
+}
+
+// Gets value from cache, falls back to the source on a miss if it's configured.
+// Rejected keys (see WithMaxKeyLen and WithRejectEmptyKeys) are a miss without loading.
+// Return: true - element exists, false - element doesn't exist
+func (l *LRUCache) Get(key Key) (any, bool) {
+	if l.rejects(key) {
+		return nil, false
+	}
+
+	if value, exist := l.get(key); exist || l.source == nil {
+		return value, exist
+	}
+
+	value, err := l.load(key, l.source.Load)
+	if err != nil || value == nil && l.rejectNilValues {
+		return nil, false
+	}
+	return value, true
+}
+
+// Gets value from cache like Get without falling back to the source and tells why it's missing.
+// An expired element that hasn't been swept yet is deleted like on Get.
+// Return: ErrNotFound - element doesn't exist, ErrExpired - element has expired,
+// ErrKeyRejected - key is rejected (see WithMaxKeyLen and WithRejectEmptyKeys)
+func (l *LRUCache) GetE(key Key) (any, error) {
+	if l.rejects(key) {
+		return nil, ErrKeyRejected
+	}
+
+	l.lock()
+	defer l.unlock()
+
+	node, exist := l.items[key]
+	expired := exist && l.expired(node.Value.(*listItem))
+	node, exist = l.read(key)
+	switch {
+	case exist:
+		return l.touch(node).value, nil
+	case expired:
+		return nil, ErrExpired
+	default:
+		return nil, ErrNotFound
+	}
+}
+
+// Gets value from cache without falling back to the source like Get, but an expired element
+// that hasn't been swept yet is returned as stale instead of being treated as a miss.
+// Stale element is kept as is: it isn't promoted, its ttl isn't refreshed and it counts as a miss,
+// so the caller can serve it while revalidating.
+// Return: value, true - element has expired, true - element exists
+func (l *LRUCache) GetAllowStale(key Key) (any, bool, bool) {
+	if l.rejects(key) {
+		return nil, false, false
+	}
+
+	l.lock()
+	defer l.unlock()
+
+	node, exist := l.items[key]
+	if exist && l.expired(node.Value.(*listItem)) {
+		l.misses++
+		return node.Value.(*listItem).value, true, true
+	}
+
+	node, exist = l.read(key)
+	if !exist {
+		return nil, false, false
+	}
+	return l.touch(node).value, false, true
+}
+
+// Gets values of several keys under a single lock acquisition.
+// Results preserve the order of keys, missing keys have Found = false.
+// Found elements are promoted and their ttl is refreshed. Keys are promoted in the order
+// of keys, so the last found key becomes the most recently used one, and a repeated key
+// is placed by its last occurrence. Missing keys don't affect the order.
+func (l *LRUCache) GetMany(keys []Key) []Result {
+	l.lock()
+	defer l.unlock()
+
+	results := make([]Result, len(keys))
+	for i, key := range keys {
+		results[i].Key = key
+		if node, exist := l.read(key); exist {
+			results[i].Value = l.touch(node).value
+			results[i].Found = true
+		}
+	}
+	return results
+}
+
+// Gets value from cache or def if the element doesn't exist.
+// A stored nil value is returned as is, use Get to tell it from a miss explicitly.
+func (l *LRUCache) GetOrDefault(key Key, def any) any {
+	if value, exist := l.Get(key); exist {
+		return value
+	}
+	return def
+}
+
+// Gets value from cache together with its remaining lifetime.
+// Remaining lifetime is zero if the element never expires.
+// Return: true - element exists, false - element doesn't exist
+func (l *LRUCache) GetWithTTL(key Key) (any, time.Duration, bool) {
+	l.lock()
+	defer l.unlock()
+
+	node, exist := l.read(key)
+	if !exist {
+		return nil, 0, false
+	}
+
+	li := l.touch(node)
+	if li.expiresAt.IsZero() {
+		return li.value, 0, true
+	}
+	return li.value, li.expiresAt.Sub(l.now()), true
+}
+
+// Gets value from cache like Get without falling back to the source
+// and reports how the access affected the element expiration
+// Return: true - element exists, false - element doesn't exist
+func (l *LRUCache) GetInfo(key Key) (any, AccessInfo, bool) {
+	l.lock()
+	defer l.unlock()
+
+	node, exist := l.read(key)
+	if !exist {
+		return nil, AccessInfo{}, false
+	}
+
+	before := node.Value.(*listItem).expiresAt
+	item := l.touch(node)
+	return item.value, AccessInfo{
+		Extended:  item.expiresAt.After(before),
+		Absolute:  item.absolute,
+		ExpiresAt: item.expiresAt,
+	}, true
+}
+
+// Promotes the existing element and refreshes its ttl without reading the value
+// Return: true - element exists, false - element doesn't exist
+func (l *LRUCache) Refresh(key Key) bool {
+	l.lock()
+	defer l.unlock()
+
+	node, exist := l.lookup(key)
+	if exist {
+		l.access(node)
+		l.refresh(node.Value.(*listItem))
+	}
+	return exist
+}
+
+// Updates value of the existing element and refreshes its ttl.
+// Return: true - element was updated, false - element doesn't exist or value doesn't fit max bytes (see WithMaxBytes), nothing changed
+func (l *LRUCache) Update(key Key, value any) bool {
+	if l.oversized(key, value) {
+		return false
+	}
+
+	l.lock()
+	defer l.unlock()
+
+	if l.deletesNil(key, value) {
+		return false
+	}
+
+	node, exist := l.lookup(key)
+	if !exist {
+		return false
+	}
+
+	l.promote(node, value)
+	return true
+}
+
+// Gets value from cache and refreshes its ttl without changing its recency,
+// so scans don't evict the hot set. Unlike Peek, ttl is refreshed.
+// Return: true - element exists, false - element doesn't exist
+func (l *LRUCache) GetQuiet(key Key) (any, bool) {
+	l.lock()
+	defer l.unlock()
+
+	node, exist := l.read(key)
+	if !exist {
+		return nil, false
+	}
+
+	item := node.Value.(*listItem)
+	l.extend(item)
+	return item.value, true
+}
+
+// Gets value from cache without changing its recency and ttl
+// Return: true - element exists, false - element doesn't exist
+func (l *LRUCache) Peek(key Key) (any, bool) {
+	l.lock()
+	defer l.unlock()
+
+	node, exist := l.lookup(key)
+	if !exist {
+		return nil, false
+	}
+	return node.Value.(*listItem).value, true
+}
+
+// Gets element expiration time without changing its recency and ttl, zero time means no expiration
+// Return: true - element exists, false - element doesn't exist
+func (l *LRUCache) Expiry(key Key) (time.Time, bool) {
+	l.lock()
+	defer l.unlock()
+
+	node, exist := l.lookup(key)
+	if !exist {
+		return time.Time{}, false
+	}
+	return node.Value.(*listItem).expiresAt, true
+}
+
+// Checks element existence without changing its recency and ttl
+func (l *LRUCache) Contains(key Key) bool {
+	l.lock()
+	defer l.unlock()
+
+	_, exist := l.lookup(key)
+	return exist
+}
+
+// Gets number of accesses to the element since it was added
+// Return: true - element exists, false - element doesn't exist
+func (l *LRUCache) AccessCount(key Key) (uint64, bool) {
+	l.lock()
+	defer l.unlock()
+
+	node, exist := l.lookup(key)
+	if !exist {
+		return 0, false
+	}
+	return atomic.LoadUint64(&node.Value.(*listItem).freq), true
+}
+
+// Gets time since the element was added without changing its recency and ttl.
+// Updates of the value don't reset the age, see SinceUpdate.
+// Return: true - element exists, false - element doesn't exist
+func (l *LRUCache) Age(key Key) (time.Duration, bool) {
+	l.lock()
+	defer l.unlock()
+
+	node, exist := l.lookup(key)
+	if !exist {
+		return 0, false
+	}
+	return l.now().Sub(node.Value.(*listItem).insertedAt), true
+}
+
+// Gets time since the element value was last set without changing its recency and ttl
+// Return: true - element exists, false - element doesn't exist
+func (l *LRUCache) SinceUpdate(key Key) (time.Duration, bool) {
+	l.lock()
+	defer l.unlock()
+
+	node, exist := l.lookup(key)
+	if !exist {
+		return 0, false
+	}
+	return l.now().Sub(node.Value.(*listItem).updatedAt), true
+}
+
+// Deletes element from cache
+// Return: true - element was deleted, false - element doesn't exist
+func (l *LRUCache) Delete(key Key) bool {
+	l.lock()
+	defer l.unlock()
+
+	node, exist := l.lookup(key)
+	if !exist {
+		return false
+	}
+	l.deleteItem(node)
+	return true
+}
+
+// Deletes elements of several keys under a single lock acquisition, absent keys are skipped
+// Return: number of deleted elements
+func (l *LRUCache) DeleteMulti(keys []Key) int {
+	l.lock()
+	defer l.unlock()
+
+	deleted := 0
+	for _, key := range keys {
+		if node, exist := l.lookup(key); exist {
+			l.deleteItem(node)
+			deleted++
+		}
+	}
+	return deleted
+}
+
+// Deletes elements for which pred returns true under a single lock acquisition.
+// pred must not call cache methods.
+// Return: number of deleted elements
+func (l *LRUCache) RemoveFunc(pred func(key Key, value any) bool) int {
+	l.lock()
+	defer l.unlock()
+
+	removed := 0
+	for node := l.queue.Front(); node != nil; {
+		next := node.Next()
+		if item := node.Value.(*listItem); pred(item.key, item.value) {
+			l.deleteItem(node)
+			removed++
+		}
+		node = next
+	}
+	return removed
+}
+
+// Returns keys starting with prefix in MRU order, empty prefix matches all keys.
+// Expired elements are skipped. Scans all elements: O(n).
+func (l *LRUCache) KeysWithPrefix(prefix Key) []Key {
+	l.lock()
+	defer l.unlock()
+
+	var keys []Key
+	for node := l.queue.Front(); node != nil; node = node.Next() {
+		item := node.Value.(*listItem)
+		if strings.HasPrefix(string(item.key), string(prefix)) && !l.expired(item) {
+			keys = append(keys, item.key)
+		}
+	}
+	return keys
+}
+
+// Returns number of elements in cache
+func (l *LRUCache) Len() int {
+	l.lock()
+	defer l.unlock()
+
+	return len(l.items)
+}
+
+// Returns number of expired elements which are still in cache waiting for the cleaner,
+// the value shows whether the cleaner keeps up with expiration
+func (l *LRUCache) ExpiredCount() int {
+	l.lock()
+	defer l.unlock()
+
+	count := 0
+	for _, item := range l.expiry {
+		if l.expired(item) {
+			count++
+		}
+	}
+	return count
+}
+
+// Counts expiring elements by remaining ttl. buckets are ascending upper bounds:
+// result[i] counts elements with remaining ttl in (buckets[i-1], buckets[i]], the extra last
+// counter holds elements beyond the last bound. Expired elements fall into the first bucket,
+// elements which never expire aren't counted.
+func (l *LRUCache) TTLHistogram(buckets []time.Duration) []int {
+	l.lock()
+	defer l.unlock()
+
+	counts := make([]int, len(buckets)+1)
+	now := l.now()
+	for _, item := range l.expiry {
+		remaining := item.expiresAt.Sub(now)
+		counts[sort.Search(len(buckets), func(i int) bool { return remaining <= buckets[i] })]++
+	}
+	return counts
+}
+
+// Adds value to cache with the absolute expiration time bypassing ttl, access doesn't refresh it.
+// Zero time means the element never expires. If the time is in the past, the element is treated
+// as already expired: it isn't added and an existing element is deleted.
+// Return: true - existing element was updated or deleted, false - new element was added or nothing changed
+func (l *LRUCache) SetWithExpiry(key Key, value any, at time.Time) bool {
+	if l.rejects(key) || l.oversized(key, value) {
+		return false
+	}
+
+	l.lock()
+	defer l.unlock()
+
+	if l.deletesNil(key, value) {
+		return false
+	}
+
+	expired := !at.IsZero() && !at.After(l.now())
+	node, exist := l.lookup(key)
+	switch {
+	case exist && expired:
+		l.evict(node, EvictExpired)
+	case exist:
+		l.promote(node, value)
+		item := node.Value.(*listItem)
+		l.setExpiry(item, at)
+		item.absolute = true
+	case !expired:
+		item := l.insert(key, value, 0)
+		l.setExpiry(item, at)
+		item.absolute = true
+	}
+	return exist
+}
+
+// Adds values under a single lock acquisition with the batch ttl overriding the default one,
+// access refreshes them by the batch ttl. Non-positive ttl means the default ttl.
+// Capacity eviction applies while adding, so a batch bigger than capacity keeps an unspecified part of it.
+func (l *LRUCache) SetMultiWithTTL(items map[Key]any, ttl time.Duration) {
+	l.lock()
+	defer l.unlock()
+
+	for key, value := range items {
+		if l.rejects(key) || l.oversized(key, value) || l.deletesNil(key, value) {
+			continue
+		}
+
+		var item *listItem
+		if node, exist := l.lookup(key); exist {
+			l.promote(node, value)
+			item = node.Value.(*listItem)
+		} else {
+			item = l.insert(key, value, 0)
+		}
+
+		if ttl > 0 {
+			item.absolute = false
+			item.ttl = ttl
+			l.refresh(item)
+		}
+	}
+}
+
+// Adds entries in order, so the last entry becomes the most recently used one
+// and capacity eviction keeps the tail of entries.
+// Entry expiration is restored from ExpiresAt, zero ExpiresAt gets the default ttl.
+// Already expired entries are skipped.
+func (l *LRUCache) Warm(entries []Entry) {
+	l.lock()
+	defer l.unlock()
+
+	for _, e := range entries {
+		if !e.ExpiresAt.IsZero() && !e.ExpiresAt.After(l.now()) || l.rejects(e.Key) || l.oversized(e.Key, e.Value) || l.deletesNil(e.Key, e.Value) {
+			continue
+		}
+
+		var item *listItem
+		if node, exist := l.lookup(e.Key); exist {
+			l.promote(node, e.Value)
+			item = node.Value.(*listItem)
+		} else {
+			item = l.insert(e.Key, e.Value, 0)
+		}
+
+		if !e.ExpiresAt.IsZero() {
+			l.setExpiry(item, e.ExpiresAt)
+		}
+	}
+}
+
+// Caches confirmed miss of the key in the backing store as Miss tombstone expiring after
+// the negative ttl (see WithNegativeTTL), access doesn't refresh the tombstone.
+// Without negative ttl the tombstone is added like a value with the default ttl.
+// Return: true - existing element was replaced, false - new tombstone was added or key is rejected
+func (l *LRUCache) SetMiss(key Key) bool {
+	if l.negativeTTL <= 0 {
+		return l.Set(key, Miss)
+	}
+
+	if l.rejects(key) || l.oversized(key, Miss) {
+		return false
+	}
+
+	l.lock()
+	defer l.unlock()
+
+	node, exist := l.lookup(key)
+	var item *listItem
+	if exist {
+		l.promote(node, Miss)
+		item = node.Value.(*listItem)
+	} else {
+		item = l.insert(key, Miss, 0)
+	}
+
+	item.ttl = l.negativeTTL
+	l.setExpiry(item, l.now().Add(l.negativeTTL))
+	item.absolute = true
+	return exist
+}
+
+// Caches confirmed miss of the key in the backing store as Miss tombstone.
+// If the tombstone already exists its ttl grows exponentially up to the configured max,
+// otherwise the tombstone gets the base ttl. A tombstone without own ttl (added by Set or SetMiss)
+// starts from the base ttl as well. Access doesn't refresh the tombstone.
+// Return: tombstone ttl, 0 if WithMissBackoff isn't configured or key is rejected and nothing changed
+func (l *LRUCache) SetMissWithBackoff(key Key) time.Duration {
+	if l.missBase <= 0 || l.rejects(key) || l.oversized(key, Miss) {
+		return 0
+	}
+
+	l.lock()
+	defer l.unlock()
+
+	ttl := l.missBase
+	var item *listItem
+	if node, exist := l.lookup(key); exist {
+		item = node.Value.(*listItem)
+		if item.value == Miss && item.ttl > 0 {
+			ttl = min(2*item.ttl, l.missMax)
+		}
+		l.promote(node, Miss)
+	} else {
+		item = l.insert(key, Miss, 0)
+	}
+
+	item.ttl = ttl
+	l.setExpiry(item, l.now().Add(ttl))
+	item.absolute = true
+	return ttl
+}
+
+// Acquires lease on the key: atomically adds the element if it's absent or expired.
+// The lease is released by ReleaseLease or automatically after ttl, access doesn't extend it.
+// Return: true - lease was acquired, false - lease is held by someone else
+func (l *LRUCache) AcquireLease(key Key, ttl time.Duration) bool {
+	if ttl <= 0 || l.rejects(key) || l.oversized(key, struct{}{}) {
+		return false
+	}
+
+	l.lock()
+	defer l.unlock()
+
+	if node, exist := l.items[key]; exist {
+		if !l.expired(node.Value.(*listItem)) {
+			return false
+		}
+		l.evict(node, EvictExpired)
+	}
+
+	item := l.insert(key, struct{}{}, 0)
+	l.setExpiry(item, l.now().Add(ttl))
+	item.absolute = true
+	return true
+}
+
+// Releases lease on the key
+func (l *LRUCache) ReleaseLease(key Key) {
+	l.Delete(key)
+}
+
+// Changes default ttl for subsequent Set and Get calls, zero disables expiration of new elements.
+// Existing elements keep their expiration time until they are touched.
+// The cleaner keeps its check interval; without WithTTL there is no cleaner
+// and expired elements are deleted lazily on access.
+func (l *LRUCache) SetDefaultTTL(ttl time.Duration) error {
+	if ttl < 0 {
+		return errors.New("ttl duration must not be negative")
+	}
+
+	l.lock()
+	defer l.unlock()
+
+	l.ttl = ttl
+	return nil
+}
+
+// Finds the element which expires first: O(1), the expiry heap keeps it on top.
+// Return: true - element found, false - cache is empty or no element expires
+func (l *LRUCache) NextExpiry() (Key, time.Time, bool) {
+	l.lock()
+	defer l.unlock()
+
+	if len(l.expiry) == 0 {
+		return "", time.Time{}, false
+	}
+
+	next := l.expiry[0]
+	return next.key, next.expiresAt, true
+}
+
+// Makes every element expire within d, so the cleaner sweeps them gradually instead of
+// dropping data at once like Clear. Elements expiring earlier keep their expiration time.
+// The new expiration time is absolute: access doesn't extend it, but updates reset it as usual.
+func (l *LRUCache) ExpireAllIn(d time.Duration) {
+	l.lock()
+	defer l.unlock()
+
+	at := l.now().Add(d)
+	for node := l.queue.Front(); node != nil; node = node.Next() {
+		item := node.Value.(*listItem)
+		if item.expiresAt.IsZero() || item.expiresAt.After(at) {
+			l.setExpiry(item, at)
+			item.absolute = true
+		}
+	}
+}
+
+// Changes cache capacity, evicts elements in eviction policy order if the cache doesn't fit it
+func (l *LRUCache) Resize(cap int) error {
+	if cap <= 0 {
+		return errors.New("cap must be positive")
+	}
+
+	l.lock()
+	defer l.unlock()
+
+	l.cap = cap
+	for len(l.items) > l.cap {
+		l.evict(l.evictor.Victim(), EvictCapacity)
+	}
+	return nil
+}
+
+// Releases memory retained after heavy churn: rebuilds the hash table, the expiry heap and the random policy nodes
+// right-sized for the current elements. Elements, their order and ttl are kept.
+// O(n) and blocks the cache meanwhile, call it sparingly, e.g. after a burst was drained.
+func (l *LRUCache) Compact() {
+	l.lock()
+	defer l.unlock()
+
+	items := make(map[Key]*list.Element, len(l.items))
+	maps.Copy(items, l.items)
+	l.items = items
+	l.expiry = slices.Clone(l.expiry)
+	if p, ok := l.evictor.(*randomPolicy); ok {
+		p.nodes = slices.Clone(p.nodes)
+	}
+}
+
+// Evicts up to n elements in eviction policy order (least recently used first for LRU),
+// eviction callback gets EvictManual reason.
+// Return: number of evicted elements
+func (l *LRUCache) ForceEvict(n int) int {
+	l.lock()
+	defer l.unlock()
+
+	n = min(n, len(l.items))
+	for range n {
+		l.evict(l.evictor.Victim(), EvictManual)
+	}
+	return max(n, 0)
+}
+
+// Checks internal invariants, a diagnostic tool for catching bugs in eviction policies.
+// Return: nil - cache is consistent, error describing the first broken invariant otherwise
+func (l *LRUCache) Validate() error {
+	l.lock()
+	defer l.unlock()
+
+	if len(l.items) != l.queue.Len() {
+		return fmt.Errorf("hash table has %d elements, queue has %d", len(l.items), l.queue.Len())
+	}
+
+	for node := l.queue.Front(); node != nil; node = node.Next() {
+		key := node.Value.(*listItem).key
+		if l.items[key] != node {
+			return fmt.Errorf("queue element %q isn't referenced by the hash table", key)
+		}
+	}
+
+	for key, node := range l.items {
+		if item := node.Value.(*listItem); item.key != key {
+			return fmt.Errorf("hash table key %q points to element %q", key, item.key)
+		}
+	}
+
+	for i, item := range l.expiry {
+		if item.heapIdx != i || item.expiresAt.IsZero() || l.items[item.key] == nil {
+			return fmt.Errorf("expiry heap element %q is out of sync", item.key)
+		}
+	}
+	return nil
+}
+
+// Returns compact cache description with keys in MRU order, e.g. LRUCache(size=3/10, ttl=5s) [k1 k2 k3].
+// At most maxStringKeys keys are shown, the rest are counted.
+func (l *LRUCache) String() string {
+	l.lock()
+	defer l.unlock()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "LRUCache(size=%d/%d, ttl=%v) [", len(l.items), l.cap, l.ttl)
+	shown := 0
+	for node := l.queue.Front(); node != nil && shown < maxStringKeys; node = node.Next() {
+		if shown > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(string(node.Value.(*listItem).key))
+		shown++
+	}
+	if rest := len(l.items) - shown; rest > 0 {
+		fmt.Fprintf(&b, " ...+%d", rest)
+	}
+	b.WriteByte(']')
+	return b.String()
+}
+
+// Checks if adding a new element causes eviction: the cache is at capacity, at int(f * cap)
+// with WithLoadFactor or at cap + slack with WithEvictionSlack
+func (l *LRUCache) IsFull() bool {
+	l.lock()
+	defer l.unlock()
+
+	return len(l.items) >= l.evictionLimit()
+}
+
+// Returns cache statistics, all fields are captured at the same moment
+func (l *LRUCache) Stats() Stats {
+	l.lock()
+	defer l.unlock()
+
+	return Stats{
+		Hits:        l.hits,
+		Misses:      l.misses,
+		MaxUsed:     l.maxUsed,
+		LockWaitAvg: l.lockWaitAvg,
+		LockWaitMax: l.lockWaitMax,
+		Dropped:     l.droppedCallbacks.Load(),
+		Abandoned:   l.abandoned.Load(),
+		Size:        len(l.items),
+		Capacity:    l.cap,
+		Utilization: float64(len(l.items)) / float64(l.cap),
+	}
+}
+
+// Cleanup methods, all of them are idempotent and safe for concurrent use:
+//
+//	Purge                          - removes data, the cleaner keeps running
+//	Close                          - stops the cleaner, data is kept
+//	Close with WithClearOnClose    - stops the cleaner and removes data
+//	Clear                          - stops the cleaner and removes data
+
+// Removes all elements, ttl checks keep running
+func (l *LRUCache) Purge() {
+	l.lock()
+	defer l.unlock()
+
+	l.reset()
+}
+
+// Clears cache, cancels ttl checks. Same as Close followed by Purge.
+func (l *LRUCache) Clear() {
+	l.Close()
+	l.Purge()
+}
+
+// Stops ttl checks and waits for the cleaner to exit, data is kept unless WithClearOnClose is set.
+// Expired elements are still deleted lazily on access. Memory pressure hook is stopped as well.
+// The cache stays usable after Close: new elements still get ttl and expire lazily on access,
+// DeleteExpired removes the rest, StartCleaner restarts the cleaner. Async callback workers run queued callbacks and exit,
+// later callbacks are called synchronously.
+func (l *LRUCache) Close() {
+	if l.hookCancel != nil {
+		l.hookCancel()
+	}
+
+	l.cleanerMu.Lock()
+	if l.cancel != nil {
+		l.cancel()
+		<-l.done
+	}
+	l.cleanerMu.Unlock()
+
+	l.stopCallbackWorkers()
+
+	if l.clearOnClose {
+		l.Purge()
+	}
+}
+
+// Returns a point-in-time copy of cache elements in MRU order without changing their recency and ttl.
+// The copy is taken under the lock and may go stale, so it can be processed at leisure
+// and the callers may call cache methods while iterating it.
+func (l *LRUCache) Snapshot() []Entry {
+	l.lock()
+	defer l.unlock()
+
+	return l.entries()
+}
+
+// Returns all elements from the most to the least recently used, a stable API for asserting
+// cache contents in tests instead of reaching into internals. Same as Snapshot.
+func (l *LRUCache) OrderedEntries() []Entry {
+	return l.Snapshot()
+}
+
+// Returns iterator over live elements in MRU order: for key, value := range cache.All().
+// The lock is held for the whole iteration, so the loop body must not call cache methods.
+// Like PeekAll, iteration doesn't change recency, ttl or access counts, expired elements are skipped.
+func (l *LRUCache) All() iter.Seq2[Key, any] {
+	return func(yield func(Key, any) bool) {
+		l.lock()
+		defer l.unlock()
+
+		for node := l.queue.Front(); node != nil; node = node.Next() {
+			item := node.Value.(*listItem)
+			if l.expired(item) {
+				continue
+			}
+			if !yield(item.key, item.value) {
+				return
+			}
+		}
+	}
+}
+
+// Returns live elements in MRU order like Peek does for a single key: no element is promoted,
+// no ttl is refreshed and no access is counted. Unlike Snapshot, expired elements are skipped,
+// but they aren't deleted, so the cache isn't changed at all.
+func (l *LRUCache) PeekAll() []Entry {
+	l.lock()
+	defer l.unlock()
+
+	entries := make([]Entry, 0, l.queue.Len())
+	for node := l.queue.Front(); node != nil; node = node.Next() {
+		if item := node.Value.(*listItem); !l.expired(item) {
+			entries = append(entries, Entry{Key: item.key, Value: item.value, ExpiresAt: item.expiresAt})
+		}
+	}
+	return entries
+}
+
+// Removes all elements from cache and returns them in MRU order.
+// Unlike Clear, ttl checks keep running.
+func (l *LRUCache) Drain() []Entry {
+	l.lock()
+	defer l.unlock()
+
+	entries := l.entries()
+	l.reset()
+	return entries
+}
+
+// Deletes expired elements immediately, without waiting for the cleaner
+func (l *LRUCache) DeleteExpired() {
+	clearExpired(l)
+}
+
+// Clears expired cache items
+func clearExpired(l *LRUCache) {
+	for l.clearExpiredBatch() {
+	}
+}
+
+// Clears up to cleanup batch size expired items under a single lock acquisition
+// Return: true - expired items may remain, false - all expired items were cleared
+func (l *LRUCache) clearExpiredBatch() bool {
+	l.lock()
+	defer l.unlock()
+
+	// expiry heap keeps the soonest expiring element on top regardless of recency order
+	for n := 0; len(l.expiry) > 0 && l.expired(l.expiry[0]); n++ {
+		if l.batchSize > 0 && n == l.batchSize {
+			return true
+		}
+		l.evict(l.items[l.expiry[0].key], EvictExpired)
+	}
+	return false
+}
+
+// Adds new node to the front of the queue evicting nodes to fit capacity and max cost
+func (l *LRUCache) insert(key Key, value any, cost int64) *listItem {
+	if limit := l.evictionLimit(); len(l.items) >= limit {
+		target := min(l.cap, limit) - 1
+		if l.lowWatermark > 0 {
+			target = min(int(l.lowWatermark*float64(l.cap)), target)
+		}
+		for len(l.items) > target {
+			l.evict(l.evictor.Victim(), EvictCapacity)
+		}
+	}
+
+	if cost == 0 && l.estimateCost {
+		cost = estimateSize(key, value)
+	}
+
+	for l.maxCost > 0 && l.cost+cost > l.maxCost && len(l.items) > 0 {
+		l.evict(l.evictor.Victim(), EvictCapacity)
+	}
+
+	newItem := itemPool.Get().(*listItem)
+	newItem.key, newItem.value, newItem.cost = key, value, cost
+	newItem.insertedAt = l.now()
+	newItem.updatedAt = newItem.insertedAt
+	l.indexValue(newItem)
+	l.refresh(newItem)
+	node := l.queue.PushFront(newItem)
+	l.evictor.OnInsert(node)
+	l.items[key] = node
+	l.cost += cost
+	l.maxUsed = max(l.maxUsed, len(l.items))
+	return newItem
+}
+
+// Number of elements starting eviction on insert, see WithEvictionSlack and WithLoadFactor
+func (l *LRUCache) evictionLimit() int {
+	if l.loadFactor > 0 {
+		// float64(cap) may round up past MaxInt, so the limit is clamped to cap before conversion
+		limit := l.loadFactor * float64(l.cap)
+		if limit >= float64(l.cap) {
+			return l.cap
+		}
+		return max(int(limit), 1)
+	}
+	if l.slack > math.MaxInt-l.cap {
+		return math.MaxInt
+	}
+	return l.cap + l.slack
+}
+
+// Refreshes item ttl (own or default), the expiration time never exceeds max age
+func (l *LRUCache) refresh(item *listItem) {
+	ttl := l.ttl
+	if item.ttl > 0 {
+		ttl = item.ttl
+	}
+
+	if ttl <= 0 || item.absolute {
+		return
+	}
+
+	now := l.now()
+	expiresAt := now.Add(ttl)
+	if l.maxAge > 0 {
+		if deadline := item.insertedAt.Add(l.maxAge); expiresAt.After(deadline) {
+			expiresAt = deadline
+		}
+	}
+	item.touchedAt = now
+	l.setExpiry(item, expiresAt)
+}
+
+// Refreshes item ttl on read unless it was refreshed within the refresh throttle, see WithRefreshThrottle
+func (l *LRUCache) extend(item *listItem) {
+	if l.refreshThrottle > 0 && !item.touchedAt.IsZero() && l.now().Sub(item.touchedAt) < l.refreshThrottle {
+		return
+	}
+	l.refresh(item)
+}
+
+// Gets value from cache without falling back to the source, starts refresh-ahead reload if the element expires soon
+func (l *LRUCache) get(key Key) (any, bool) {
+	l.lock()
+	defer l.unlock()
+
+	node, exist := l.read(key)
+	if !exist {
+		return nil, false
+	}
+
+	if l.refreshAhead > 0 && l.source != nil {
+		if expiresAt := node.Value.(*listItem).expiresAt; !expiresAt.IsZero() && expiresAt.Sub(l.now()) <= l.refreshAhead {
+			l.reload(key)
+		}
+	}
+	return l.touch(node).value, true
+}
+
+// Finds node for reading, counts hit or miss and runs auto tuning
+func (l *LRUCache) read(key Key) (*list.Element, bool) {
+	node, exist := l.lookup(key)
+	if exist {
+		l.hits++
+	} else {
+		l.misses++
+	}
+
+	if l.tuneWindow > 0 {
+		l.autoTune(exist)
+	}
+	return node, exist
+}
+
+// Grows capacity if the hit ratio of the last window is below the threshold and the cache is full
+func (l *LRUCache) autoTune(hit bool) {
+	l.windowReads++
+	if hit {
+		l.windowHits++
+	}
+
+	if l.windowReads < l.tuneWindow {
+		return
+	}
+
+	ratio := float64(l.windowHits) / float64(l.windowReads)
+	l.windowReads, l.windowHits = 0, 0
+	if ratio < l.minHitRatio && len(l.items) >= min(l.cap, l.evictionLimit()) && l.cap < l.maxCap {
+		l.cap = min(2*l.cap, l.maxCap)
+	}
+}
+
+// Deletes the element if value is nil and nil values are rejected, see WithRejectNilValues
+// Return: true - value is rejected, false - value must be stored
+func (l *LRUCache) deletesNil(key Key, value any) bool {
+	if value != nil || !l.rejectNilValues {
+		return false
+	}
+
+	if node, exist := l.lookup(key); exist {
+		l.deleteItem(node)
+	}
+	return true
+}
+
+// Checks if the key can't be added to cache, see WithMaxKeyLen and WithRejectEmptyKeys
+func (l *LRUCache) rejects(key Key) bool {
+	return l.maxKeyLen > 0 && len(key) > l.maxKeyLen || l.rejectEmptyKeys && key == ""
+}
+
+// Finds node by key, expired node is deleted and treated as absent
+func (l *LRUCache) lookup(key Key) (*list.Element, bool) {
+	node, exist := l.items[key]
+	if !exist {
+		return nil, false
+	}
+
+	if l.expired(node.Value.(*listItem)) {
+		l.evict(node, EvictExpired)
+		return nil, false
+	}
+	return node, true
+}
+
+// Checks if the item has expired
+func (l *LRUCache) expired(item *listItem) bool {
+	return !item.expiresAt.IsZero() && !item.expiresAt.After(l.now())
+}
+
+// Sets new node value, refreshes ttl (unless WithNoRefreshOnUpdate is set) and registers access.
+// An unchanged value (see WithValueEquals) only registers access.
+func (l *LRUCache) promote(node *list.Element, value any) {
+	item := node.Value.(*listItem)
+	if l.valueEquals != nil && l.valueEquals(item.value, value) {
+		l.access(node)
+		return
+	}
+
+	l.unindexValue(item)
+	item.value = value
+	l.indexValue(item)
+	item.updatedAt = l.now()
+	l.access(node)
+	if l.estimateCost {
+		l.resize(node, estimateSize(item.key, value))
+	}
+	if !l.noRefreshOnUpdate {
+		item.absolute = false
+		item.ttl = 0
+		l.refresh(item)
+	}
+}
+
+// Refreshes node ttl (see WithRefreshThrottle) and registers access
+func (l *LRUCache) touch(node *list.Element) *listItem {
+	item := node.Value.(*listItem)
+	l.access(node)
+	l.extend(item)
+	return item
+}
+
+// Registers access to the node
+func (l *LRUCache) access(node *list.Element) {
+	atomic.AddUint64(&node.Value.(*listItem).freq, 1)
+	l.evictor.OnAccess(node)
+}
+
+// Evicts fraction of elements, keeps at least min size elements
+func (l *LRUCache) shrink(fraction float64) {
+	l.lock()
+	defer l.unlock()
+
+	target := max(len(l.items)-int(float64(len(l.items))*fraction), l.minSize)
+	for len(l.items) > target {
+		l.evict(l.evictor.Victim(), EvictCapacity)
+	}
+}
+
+// Collects cache elements in MRU order
+func (l *LRUCache) entries() []Entry {
+	entries := make([]Entry, 0, l.queue.Len())
+	for node := l.queue.Front(); node != nil; node = node.Next() {
+		item := node.Value.(*listItem)
+		entries = append(entries, Entry{Key: item.key, Value: item.value, ExpiresAt: item.expiresAt})
+	}
+	return entries
+}
+
+// Copies live items in LRU order, see adopt
+func (l *LRUCache) export() []listItem {
+	l.lock()
+	defer l.unlock()
+
+	items := make([]listItem, 0, len(l.items))
+	for node := l.queue.Back(); node != nil; node = node.Prev() {
+		if item := node.Value.(*listItem); !l.expired(item) {
+			items = append(items, *item)
+		}
+	}
+	return items
+}
+
+// Adds exported item as the most recently used element keeping its expiration and bookkeeping.
+// Eviction callbacks aren't run, the caller runs them by flush.
+// Return: elements waiting for the callbacks
+func (l *LRUCache) adopt(item listItem) []evicted {
+	l.lock()
+
+	if node, exist := l.items[item.key]; exist {
+		l.deleteItem(node)
+	}
+
+	newItem := l.insert(item.key, item.value, item.cost)
+	newItem.freq = item.freq
+	if p, ok := l.evictor.(*lfuPolicy); ok {
+		// moves the node to the bucket of the copied access count
+		p.OnAccess(l.items[item.key])
+	}
+	newItem.insertedAt, newItem.updatedAt = item.insertedAt, item.updatedAt
+	newItem.absolute, newItem.ttl, newItem.touchedAt = item.absolute, item.ttl, item.touchedAt
+	newItem.meta = item.meta
+	l.setExpiry(newItem, item.expiresAt)
+	return l.detach()
+}
+
+// Removes all elements
+func (l *LRUCache) reset() {
+	clear(l.items)
+	l.queue.Init()
+	l.evictor = newEvictionPolicy(l)
+	clear(l.expiry)
+	l.expiry = l.expiry[:0]
+	l.cost = 0
+	clear(l.valueIndex)
+}
+
+// Deletes node and schedules eviction callback
+func (l *LRUCache) evict(node *list.Element, reason EvictReason) {
+	if l.setResult != nil && reason == EvictCapacity {
+		if !l.setResult.Evicted {
+			l.setResult.Evicted, l.setResult.EvictedKey = true, node.Value.(*listItem).key
+		}
+		l.setResult.EvictedCount++
+	}
+
+	if l.onEvict != nil || l.onExpire != nil && reason == EvictExpired {
+		item := node.Value.(*listItem)
+		l.pending = append(l.pending, evicted{key: item.key, value: item.value, reason: reason})
+	}
+	l.deleteItem(node)
+}
+
+// Locks cache recording the lock wait time if lock profiling is enabled
+func (l *LRUCache) lock() {
+	if !l.lockProfiling {
+		l.mu.Lock()
+		return
+	}
+
+	start := time.Now()
+	l.mu.Lock()
+	wait := time.Since(start)
+
+	// exponentially weighted moving average
+	if l.lockWaitAvg == 0 {
+		l.lockWaitAvg = wait
+	} else {
+		l.lockWaitAvg += (wait - l.lockWaitAvg) / lockWaitWeight
+	}
+	l.lockWaitMax = max(l.lockWaitMax, wait)
+}
+
+// Wraps release for callers which don't need the number of dropped callbacks
+func (l *LRUCache) unlock() {
+	l.release()
+}
+
+// Unlocks cache and runs eviction callbacks scheduled under the lock
+// Return: number of elements with dropped callbacks
+func (l *LRUCache) release() int {
+	return l.flush(l.detach())
+}
+
+// Unlocks cache without running eviction callbacks scheduled under the lock
+// Return: elements waiting for the callbacks, see flush
+func (l *LRUCache) detach() []evicted {
+	pending := l.pending
+	l.pending = nil
+	l.mu.Unlock()
+	return pending
+}
+
+// Runs or dispatches eviction callbacks of the pending elements, must be called without the lock
+// Return: number of elements with dropped callbacks
+func (l *LRUCache) flush(pending []evicted) int {
+	dropped := 0
+	for _, e := range pending {
+		switch handled, full := l.dispatch(e); {
+		case full:
+			dropped++
+		case !handled:
+			l.runCallbacks(e)
+		}
+	}
+	return dropped
+}
+
+// Runs eviction and expiration callbacks of the element
+func (l *LRUCache) runCallbacks(e evicted) {
+	if l.onEvict != nil {
+		l.watchCall(func() { l.onEvict(e.key, e.value, e.reason) })
+	}
+	if l.onExpire != nil && e.reason == EvictExpired {
+		l.watchCall(func() { l.onExpire(e.key, e.value) })
+	}
+}
+
+// Calls callback recovering its panic, so it can't break the cache or the cleaner
+func (l *LRUCache) safeCall(fn func()) {
+	defer func() {
+		if r := recover(); r != nil && l.onPanic != nil {
+			l.onPanic(r)
+		}
+	}()
+	fn()
+}
+
+// Deletes node from the queue and the hashtable
+func (l *LRUCache) deleteItem(node *list.Element) {
+	l.evictor.OnRemove(node)
+	l.queue.Remove(node)
+	item := node.Value.(*listItem)
+	if !item.expiresAt.IsZero() {
+		heap.Remove(&l.expiry, item.heapIdx)
+	}
+	l.cost -= item.cost
+	delete(l.items, item.key)
+	l.unindexValue(item)
+
+	*item = listItem{}
+	itemPool.Put(item)
 }
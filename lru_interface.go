@@ -3,5 +3,12 @@ package lrucache
 type Cache interface {
 	Set(key Key, value any) bool
 	Get(key Key) (any, bool)
+	Peek(key Key) (any, bool)
+	Contains(key Key) bool
+	Delete(key Key) bool
+	Len() int
 	Clear()
 }
+
+// Fails the build if *LRUCache diverges from Cache
+var _ Cache = (*LRUCache)(nil)
@@ -1,8 +1,14 @@
 package lrucache
 
 import (
+	"errors"
+	"math"
+	"math/rand"
 	"reflect"
+	"runtime"
 	"strconv"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -116,6 +122,105 @@ func TestNew(t *testing.T) {
 
 }
 
+func TestNewHugeCapacity(t *testing.T) {
+	const maxAlloc = 64 << 20
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	cache, err := New(math.MaxInt)
+	runtime.ReadMemStats(&after)
+
+	if err != nil {
+		t.Fatalf("not expected error = %v", err)
+	}
+
+	if got := after.TotalAlloc - before.TotalAlloc; got > maxAlloc {
+		t.Errorf("too big upfront allocation: got = %v, want <= %v", got, maxAlloc)
+	}
+
+	cache.Set("one", 1)
+	if got, want := cache.cap, math.MaxInt; got != want {
+		t.Errorf("logical capacity must be kept: got = %v, want = %v", got, want)
+	}
+}
+
+func TestNewHugeCapacityWithSlack(t *testing.T) {
+	const slack = 2
+
+	cache, err := New(math.MaxInt, WithEvictionSlack(slack))
+	if err != nil {
+		t.Fatalf("not expected error = %v", err)
+	}
+
+	cache.Set("one", 1)
+	cache.Set("two", 2)
+	if got := cache.Len(); got != 2 {
+		t.Errorf("got = %v, want = %v", got, 2)
+	}
+}
+
+func TestNewHugeCapacityWithLoadFactor(t *testing.T) {
+	const count = 5
+
+	cache, err := New(math.MaxInt, WithLoadFactor(1))
+	if err != nil {
+		t.Fatalf("not expected error = %v", err)
+	}
+
+	for i := range count {
+		cache.Set(IntKey(i), i)
+	}
+	if got := cache.Len(); got != count {
+		t.Errorf("got = %v, want = %v", got, count)
+	}
+}
+
+func TestNewWithOptions(t *testing.T) {
+	t.Run("default capacity", func(t *testing.T) {
+		t.Parallel()
+		got, err := NewWithOptions()
+
+		if err != nil {
+			t.Errorf("not expected error = %v", err)
+		}
+		if got.cap != DefaultCapacity {
+			t.Errorf("invalid capacity got = %v, want = %v", got.cap, DefaultCapacity)
+		}
+
+		if got.items == nil {
+			t.Error("map not initialised")
+		}
+	})
+
+	t.Run("capacity via option", func(t *testing.T) {
+		t.Parallel()
+		const cap = 3
+		got, err := NewWithOptions(WithCapacity(cap))
+
+		if err != nil {
+			t.Errorf("not expected error = %v", err)
+		}
+		if got.cap != cap {
+			t.Errorf("invalid capacity got = %v, want = %v", got.cap, cap)
+		}
+
+		for i := range cap + 1 {
+			got.Set(Key(strconv.Itoa(i)), i)
+		}
+
+		if got, want := got.queue.Len(), cap; got != want {
+			t.Errorf("cache.queue is oversized: got = %v; want = %v", got, want)
+		}
+	})
+
+	t.Run("invalid capacity", func(t *testing.T) {
+		t.Parallel()
+		if _, err := NewWithOptions(WithCapacity(0)); err == nil {
+			t.Errorf("error expected")
+		}
+	})
+}
+
 func TestWithTTL(t *testing.T) {
 	t.Run("number of cleans per ttl period", func(t *testing.T) {
 		t.Parallel()
@@ -132,6 +237,7 @@ func TestWithTTL(t *testing.T) {
 		}
 
 		WithTTL(ttl, ticks)(lruCache)
+		lruCache.start()
 		time.Sleep(ttl)
 		lruCache.cancel()
 
@@ -247,6 +353,30 @@ func TestSet(t *testing.T) {
 
 	})
 
+	t.Run("trims pre-existing overflow", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap     = 2
+			overCap = 5
+		)
+		cache, _ := New(overCap)
+		for i := range overCap {
+			cache.Set(Key(strconv.Itoa(i)), i)
+		}
+		cache.cap = cap
+
+		cache.Set("new", 0)
+
+		if got := cache.Len(); got != cap {
+			t.Errorf("cache must be trimmed to capacity: got = %v, want = %v", got, cap)
+		}
+
+		if !cache.Contains("new") || !cache.Contains(Key(strconv.Itoa(overCap-1))) {
+			t.Error("most recently used elements must be kept")
+		}
+	})
+
 	t.Run("overflow", func(t *testing.T) {
 		t.Parallel()
 		items := []listItem{
@@ -262,10 +392,12 @@ func TestSet(t *testing.T) {
 		}
 
 		const cap = 2
-		cache, _ := New(cap)
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		cache, _ := New(cap, WithNowFunc(func() time.Time { return now }))
 
-		for _, v := range items {
+		for i, v := range items {
 			cache.Set(v.key, v.value)
+			items[i].insertedAt, items[i].updatedAt = now, now
 		}
 
 		if _, exist := cache.items[items[0].key]; exist {
@@ -367,3 +499,4097 @@ func TestClear(t *testing.T) {
 	}
 
 }
+
+func TestUpdate(t *testing.T) {
+	t.Run("update existing", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap   = 2
+			ttl   = 20 * time.Second
+			ticks = 2
+		)
+
+		cache, _ := New(cap, WithTTL(ttl, ticks))
+		cache.cancel()
+
+		cache.Set("one", 1)
+		origExpTime := cache.queue.Front().Value.(*listItem).expiresAt
+		cache.Set("two", 2)
+
+		if !cache.Update("one", "ONE") {
+			t.Error("updated existing item: true expected")
+		}
+
+		got := cache.queue.Front().Value.(*listItem)
+		if got.key != "one" || got.value != "ONE" {
+			t.Errorf("item wasn't promoted or updated: got = %v", got)
+		}
+
+		if got.expiresAt.Sub(origExpTime) <= 0 {
+			t.Errorf("expiresAt field wasn't updated: origValue = %v, newValue = %v", origExpTime, got.expiresAt)
+		}
+	})
+
+	t.Run("update absent", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 2
+		cache, _ := New(cap)
+		cache.Set("one", 1)
+
+		if cache.Update("two", 2) {
+			t.Error("updated absent item: false expected")
+		}
+
+		if _, exist := cache.items["two"]; exist {
+			t.Error("absent item must not be inserted")
+		}
+
+		if got, want := cache.queue.Len(), 1; got != want {
+			t.Errorf("invalid queue length: got = %v, want = %v", got, want)
+		}
+	})
+}
+
+func TestGetWithTTL(t *testing.T) {
+	t.Run("with ttl", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap   = 2
+			ttl   = 20 * time.Second
+			ticks = 2
+		)
+
+		cache, _ := New(cap, WithTTL(ttl, ticks))
+		cache.cancel()
+
+		cache.Set("one", 1)
+		cache.Set("two", 2)
+
+		value, remaining, exist := cache.GetWithTTL("one")
+		if !exist {
+			t.Fatal("true expected")
+		}
+
+		if value != 1 {
+			t.Errorf("invalid value: got = %v, want = %v", value, 1)
+		}
+
+		if remaining <= ttl-time.Second || remaining > ttl {
+			t.Errorf("remaining must be close to ttl: got = %v, want = %v", remaining, ttl)
+		}
+
+		if got := cache.queue.Front().Value.(*listItem).key; got != "one" {
+			t.Errorf("element wasn't promoted: front = %v", got)
+		}
+	})
+
+	t.Run("without ttl", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 2
+		cache, _ := New(cap)
+		cache.Set("one", 1)
+
+		_, remaining, exist := cache.GetWithTTL("one")
+		if !exist {
+			t.Error("true expected")
+		}
+
+		if remaining != 0 {
+			t.Errorf("zero remaining expected: got = %v", remaining)
+		}
+	})
+
+	t.Run("own expiry without ttl", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap      = 2
+			lifetime = time.Hour
+		)
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		cache, _ := New(cap, WithNowFunc(func() time.Time { return now }))
+		cache.SetWithExpiry("one", 1, now.Add(lifetime))
+
+		if _, remaining, _ := cache.GetWithTTL("one"); remaining != lifetime {
+			t.Errorf("got = %v, want = %v", remaining, lifetime)
+		}
+	})
+
+	t.Run("not existing", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 2
+		cache, _ := New(cap)
+
+		value, remaining, exist := cache.GetWithTTL("one")
+		if value != nil || remaining != 0 || exist {
+			t.Errorf("miss expected: got = %v, %v, %v", value, remaining, exist)
+		}
+	})
+}
+
+func TestEvictionPolicy(t *testing.T) {
+	cases := []struct {
+		name    string
+		policy  Policy
+		evicted Key
+		kept    Key
+	}{
+		{
+			"lru drops hot key",
+			PolicyLRU,
+			"hot",
+			"cold",
+		},
+		{
+			"lfu keeps hot key",
+			PolicyLFU,
+			"cold",
+			"hot",
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			const cap = 2
+			cache, _ := New(cap, WithEvictionPolicy(tt.policy))
+
+			cache.Set("hot", 1)
+			for range 3 {
+				cache.Get("hot")
+			}
+			cache.Set("cold", 2)
+			cache.Set("new", 3)
+
+			if _, exist := cache.items[tt.evicted]; exist {
+				t.Errorf("key %v must be evicted", tt.evicted)
+			}
+
+			if _, exist := cache.items[tt.kept]; !exist {
+				t.Errorf("key %v must be kept", tt.kept)
+			}
+		})
+	}
+
+	t.Run("lfu ties broken by recency", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 3
+		cache, _ := New(cap, WithEvictionPolicy(PolicyLFU))
+
+		cache.Set("one", 1)
+		cache.Set("two", 2)
+		cache.Set("three", 3)
+		cache.Get("one")
+		cache.Set("four", 4)
+
+		if _, exist := cache.items["two"]; exist {
+			t.Error("least recently used key among least frequently used must be evicted")
+		}
+	})
+
+	t.Run("lfu victim matches full scan", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap = 50
+			ops = 5000
+		)
+		rnd := rand.New(rand.NewSource(1))
+		cache, _ := New(cap, WithEvictionPolicy(PolicyLFU))
+
+		for range ops {
+			key := IntKey(rnd.Intn(2 * cap))
+			switch rnd.Intn(3) {
+			case 0:
+				cache.Set(key, 0)
+			case 1:
+				cache.Get(key)
+			default:
+				cache.Delete(key)
+			}
+
+			// the least frequently used node, ties are kept by the least recently used one
+			want := cache.queue.Back()
+			for node := want; node != nil; node = node.Prev() {
+				if node.Value.(*listItem).freq < want.Value.(*listItem).freq {
+					want = node
+				}
+			}
+			if got := cache.evictor.Victim(); got != want {
+				t.Fatalf("got = %v, want = %v", got.Value.(*listItem).key, want.Value.(*listItem).key)
+			}
+		}
+	})
+
+	t.Run("2q keeps working set during scan", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 4
+		hot := []Key{"hot1", "hot2"}
+		cache, _ := New(cap, WithEvictionPolicy(Policy2Q))
+
+		for _, key := range hot {
+			cache.Set(key, key)
+			cache.Get(key)
+		}
+
+		for i := range 10 * cap {
+			cache.Set(Key("cold"+strconv.Itoa(i)), i)
+		}
+
+		for _, key := range hot {
+			if _, exist := cache.items[key]; !exist {
+				t.Errorf("hot key %v must survive the scan", key)
+			}
+		}
+
+		if got, want := cache.queue.Len(), cap; got != want {
+			t.Errorf("cache.queue is oversized: got = %v; want = %v", got, want)
+		}
+	})
+
+	t.Run("fifo ignores access recency", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap   = 2
+			ttl   = 20 * time.Second
+			ticks = 2
+		)
+		cache, _ := New(cap, WithTTL(ttl, ticks), WithEvictionPolicy(PolicyFIFO))
+		cache.cancel()
+
+		cache.Set("one", 1)
+		origExpTime := cache.items["one"].Value.(*listItem).expiresAt
+		cache.Set("two", 2)
+		cache.Get("one")
+		cache.Set("one", "ONE")
+
+		if newExpTime := cache.items["one"].Value.(*listItem).expiresAt; newExpTime.Sub(origExpTime) <= 0 {
+			t.Errorf("expiresAt field wasn't updated: origValue = %v, newValue = %v", origExpTime, newExpTime)
+		}
+
+		cache.Set("three", 3)
+
+		if _, exist := cache.items["one"]; exist {
+			t.Error("first inserted key must be evicted")
+		}
+
+		if _, exist := cache.items["two"]; !exist {
+			t.Error("second inserted key must be kept")
+		}
+	})
+
+	t.Run("random is deterministic for seeded source", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap  = 4
+			seed = 42
+		)
+
+		run := func() []Key {
+			var evicted []Key
+			cache, _ := New(cap,
+				WithEvictionPolicy(PolicyRandom),
+				WithRandSource(rand.NewSource(seed)),
+				WithOnEvict(func(key Key, _ any, _ EvictReason) {
+					evicted = append(evicted, key)
+				}),
+			)
+
+			for i := range 5 * cap {
+				cache.Set(Key(strconv.Itoa(i)), i)
+			}
+
+			if got := cache.Len(); got != cap {
+				t.Errorf("invalid cache size: got = %v, want = %v", got, cap)
+			}
+			return evicted
+		}
+
+		first, second := run(), run()
+		if len(first) != 4*cap {
+			t.Errorf("invalid number of evictions: got = %v, want = %v", len(first), 4*cap)
+		}
+
+		if !reflect.DeepEqual(first, second) {
+			t.Errorf("eviction choices differ: first = %v, second = %v", first, second)
+		}
+	})
+
+	t.Run("unknown policy", func(t *testing.T) {
+		t.Parallel()
+
+		if _, err := New(2, WithEvictionPolicy(Policy(-1))); err == nil {
+			t.Error("error expected")
+		}
+	})
+}
+
+func TestSetWithCost(t *testing.T) {
+	const (
+		cap     = 10
+		maxCost = 10
+	)
+
+	cases := []struct {
+		name string
+		cost int64
+		ok   bool
+	}{
+		{
+			"oversized item",
+			maxCost + 1,
+			false,
+		},
+		{
+			"item at the limit",
+			maxCost,
+			true,
+		},
+		{
+			"negative cost",
+			-1,
+			false,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cache, _ := New(cap, WithMaxCost(maxCost))
+			cache.SetWithCost("small", 1, 1)
+
+			if got := cache.SetWithCost("big", 2, tt.cost); got != tt.ok {
+				t.Errorf("invalid result: got = %v, want = %v", got, tt.ok)
+			}
+
+			if _, exist := cache.items["big"]; exist != tt.ok {
+				t.Errorf("invalid big item presence: got = %v, want = %v", exist, tt.ok)
+			}
+
+			// rejected item must not evict anything
+			if _, exist := cache.items["small"]; exist == tt.ok {
+				t.Errorf("invalid small item presence: got = %v, want = %v", exist, !tt.ok)
+			}
+
+			if cache.cost > maxCost {
+				t.Errorf("total cost exceeds max cost: got = %v, want <= %v", cache.cost, maxCost)
+			}
+		})
+	}
+
+	t.Run("evicts to fit", func(t *testing.T) {
+		t.Parallel()
+
+		cache, _ := New(cap, WithMaxCost(maxCost))
+		for i := range 4 {
+			cache.SetWithCost(Key(strconv.Itoa(i)), i, 3)
+		}
+
+		if _, exist := cache.items["0"]; exist {
+			t.Error("least recently used item must be evicted")
+		}
+
+		if got, want := cache.cost, int64(9); got != want {
+			t.Errorf("invalid total cost: got = %v, want = %v", got, want)
+		}
+	})
+}
+
+func TestCacheInterface(t *testing.T) {
+	t.Parallel()
+
+	const cap = 2
+	lruCache, _ := New(cap)
+
+	var cache Cache = lruCache
+
+	cache.Set("one", 1)
+	cache.Set("two", 2)
+
+	if got, exist := cache.Peek("one"); !exist || got != 1 {
+		t.Errorf("invalid peek: got = %v, %v", got, exist)
+	}
+
+	// Peek mustn't promote the element
+	if got := lruCache.queue.Back().Value.(*listItem).key; got != "one" {
+		t.Errorf("element was promoted by Peek: back = %v", got)
+	}
+
+	if !cache.Contains("two") {
+		t.Error("true expected")
+	}
+
+	if got, want := cache.Len(), 2; got != want {
+		t.Errorf("invalid length: got = %v, want = %v", got, want)
+	}
+
+	if !cache.Delete("one") {
+		t.Error("deleted existing: true expected")
+	}
+
+	if cache.Delete("one") {
+		t.Error("deleted absent: false expected")
+	}
+
+	if cache.Contains("one") {
+		t.Error("false expected")
+	}
+
+	if got, want := cache.Len(), 1; got != want {
+		t.Errorf("invalid length: got = %v, want = %v", got, want)
+	}
+}
+
+func TestAccessCount(t *testing.T) {
+	t.Parallel()
+
+	const cap = 2
+	cache, _ := New(cap)
+
+	if _, exist := cache.AccessCount("one"); exist {
+		t.Error("false expected")
+	}
+
+	cache.Set("one", 1)
+	for i := range 3 {
+		if got, _ := cache.AccessCount("one"); got != uint64(i) {
+			t.Errorf("invalid access count: got = %v, want = %v", got, i)
+		}
+		cache.Get("one")
+	}
+
+	cache.Delete("one")
+	cache.Set("one", 1)
+
+	if got, exist := cache.AccessCount("one"); !exist || got != 0 {
+		t.Errorf("access count wasn't reset: got = %v, %v", got, exist)
+	}
+}
+
+func BenchmarkGet(b *testing.B) {
+	const cap = 1024
+	cache, _ := New(cap)
+
+	keys := make([]Key, cap)
+	for i := range keys {
+		keys[i] = Key(strconv.Itoa(i))
+		cache.Set(keys[i], i)
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			cache.Get(keys[i%cap])
+			i++
+		}
+	})
+}
+
+func TestItemRecycling(t *testing.T) {
+	t.Parallel()
+
+	const (
+		cap     = 2
+		maxCost = 100
+		rounds  = 100
+	)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache, _ := New(cap, WithMaxCost(maxCost), WithNowFunc(func() time.Time { return now }))
+
+	for i := range rounds {
+		cache.SetWithMeta("stale", i, "meta")
+		cache.SetWithCost("stale", i, 10)
+		cache.SetWithExpiry("stale", i, now.Add(time.Hour))
+		cache.Get("stale")
+		cache.Delete("stale")
+
+		cache.Set("fresh", i)
+		node := cache.items["fresh"]
+		want := &listItem{key: "fresh", value: i, insertedAt: now, updatedAt: now, heapIdx: node.Value.(*listItem).heapIdx}
+		if got := node.Value.(*listItem); !reflect.DeepEqual(got, want) {
+			t.Fatalf("recycled item carries stale fields: got = %+v, want = %+v", got, want)
+		}
+		cache.Delete("fresh")
+	}
+
+	if cache.cost != 0 {
+		t.Errorf("invalid total cost: got = %v, want = %v", cache.cost, 0)
+	}
+}
+
+func TestConcurrentDistinctKeys(t *testing.T) {
+	t.Parallel()
+
+	const (
+		cap        = 64
+		goroutines = 16
+		keys       = 4
+		ops        = 1000
+	)
+	cache, _ := New(cap)
+
+	var wg sync.WaitGroup
+	for g := range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range ops {
+				key := Key(strconv.Itoa(g*keys + i%keys))
+				cache.Set(key, i)
+				if got, ok := cache.Get(key); !ok || got != i {
+					t.Errorf("own key update lost: got = %v, want = %v", got, i)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := cache.Validate(); err != nil {
+		t.Errorf("not expected error = %v", err)
+	}
+
+	if got, want := cache.Len(), goroutines*keys; got != want {
+		t.Errorf("invalid length: got = %v, want = %v", got, want)
+	}
+}
+
+func BenchmarkSetParallelDistinctKeys(b *testing.B) {
+	const cap = 1024
+	cache, _ := New(cap)
+
+	var next atomic.Int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		key := Key(strconv.FormatInt(next.Add(1), 10))
+		i := 0
+		for pb.Next() {
+			cache.Set(key, i)
+			i++
+		}
+	})
+}
+
+func BenchmarkSetEvict(b *testing.B) {
+	const cap = 1024
+
+	keys := make([]Key, cap*4)
+	for i := range keys {
+		keys[i] = Key(strconv.Itoa(i))
+	}
+	cache, _ := New(cap)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := range b.N {
+		cache.Set(keys[i%len(keys)], i)
+	}
+}
+
+func BenchmarkSetEvictLFU(b *testing.B) {
+	const cap = 100000
+
+	keys := make([]Key, cap*4)
+	for i := range keys {
+		keys[i] = Key(strconv.Itoa(i))
+	}
+	cache, _ := New(cap, WithEvictionPolicy(PolicyLFU))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := range b.N {
+		cache.Set(keys[i%len(keys)], i)
+	}
+}
+
+func BenchmarkSetEvict2QScan(b *testing.B) {
+	const cap = 20000
+
+	keys := make([]Key, cap*4)
+	for i := range keys {
+		keys[i] = Key(strconv.Itoa(i))
+	}
+	cache, _ := New(cap, WithEvictionPolicy(Policy2Q))
+	for _, key := range keys[:cap] {
+		cache.Set(key, key)
+		cache.Get(key)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := range b.N {
+		// a cold scan of new keys keeps the main queue full
+		cache.Set(keys[cap+i%(len(keys)-cap)], i)
+	}
+}
+
+func TestWithMaxAge(t *testing.T) {
+	t.Run("caps refreshed expiration", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap    = 2
+			ttl    = 20 * time.Second
+			ticks  = 2
+			maxAge = time.Second
+		)
+
+		cache, _ := New(cap, WithTTL(ttl, ticks), WithMaxAge(maxAge))
+		cache.cancel()
+
+		cache.Set("one", 1)
+		cache.Get("one")
+
+		item := cache.items["one"].Value.(*listItem)
+		if got, want := item.expiresAt, item.insertedAt.Add(maxAge); !got.Equal(want) {
+			t.Errorf("expiresAt exceeds max age: got = %v, want = %v", got, want)
+		}
+	})
+
+	t.Run("hot entry expires", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap    = 2
+			ttl    = 100 * time.Millisecond
+			ticks  = 4
+			maxAge = 200 * time.Millisecond
+		)
+
+		cache, _ := New(cap, WithTTL(ttl, ticks), WithMaxAge(maxAge))
+		defer cache.cancel()
+
+		start := time.Now()
+		cache.Set("one", 1)
+
+		for time.Since(start) < 10*maxAge {
+			if _, exist := cache.Get("one"); !exist {
+				break
+			}
+			time.Sleep(ttl / 10)
+		}
+
+		if got := time.Since(start); got < maxAge || got >= 10*maxAge {
+			t.Errorf("hot entry must expire after max age: got = %v, want = %v", got, maxAge)
+		}
+	})
+
+	t.Run("invalid max age", func(t *testing.T) {
+		t.Parallel()
+
+		if _, err := New(2, WithMaxAge(0)); err == nil {
+			t.Error("error expected")
+		}
+	})
+}
+
+func TestLease(t *testing.T) {
+	t.Run("single holder", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap        = 2
+			ttl        = 100 * time.Millisecond
+			goroutines = 10
+		)
+
+		cache, _ := New(cap)
+
+		var (
+			acquired int64
+			wg       sync.WaitGroup
+		)
+		for range goroutines {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if cache.AcquireLease("lock", ttl) {
+					atomic.AddInt64(&acquired, 1)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if got := atomic.LoadInt64(&acquired); got != 1 {
+			t.Errorf("lease must be acquired once: got = %v", got)
+		}
+
+		time.Sleep(ttl)
+
+		if !cache.AcquireLease("lock", ttl) {
+			t.Error("expired lease must be acquired")
+		}
+	})
+
+	t.Run("release", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap = 2
+			ttl = 20 * time.Second
+		)
+
+		cache, _ := New(cap)
+
+		if !cache.AcquireLease("lock", ttl) {
+			t.Error("true expected")
+		}
+
+		cache.ReleaseLease("lock")
+
+		if !cache.AcquireLease("lock", ttl) {
+			t.Error("released lease must be acquired")
+		}
+	})
+}
+
+func TestWithOnEvict(t *testing.T) {
+	t.Run("expired", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap   = 4
+			ttl   = 50 * time.Millisecond
+			ticks = 4
+		)
+
+		var (
+			mu  sync.Mutex
+			got = make(map[Key]EvictReason)
+		)
+		cache, _ := New(cap, WithTTL(ttl, ticks), WithOnEvict(func(key Key, _ any, reason EvictReason) {
+			mu.Lock()
+			defer mu.Unlock()
+			got[key] = reason
+		}))
+		defer cache.cancel()
+
+		for i := range cap {
+			cache.Set(Key(strconv.Itoa(i)), i)
+		}
+		time.Sleep(ttl * 3)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if len(got) != cap {
+			t.Errorf("callback must fire for each expired key: got = %v", got)
+		}
+
+		for key, reason := range got {
+			if reason != EvictExpired {
+				t.Errorf("invalid reason for key %v: got = %v, want = %v", key, reason, EvictExpired)
+			}
+		}
+	})
+
+	t.Run("capacity", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 1
+
+		var (
+			got   []Key
+			cache *LRUCache
+		)
+		cache, _ = New(cap, WithOnEvict(func(key Key, _ any, reason EvictReason) {
+			if reason != EvictCapacity {
+				t.Errorf("invalid reason: got = %v, want = %v", reason, EvictCapacity)
+			}
+			// the lock is released before the callback
+			cache.Len()
+			got = append(got, key)
+		}))
+
+		cache.Set("one", 1)
+		cache.Set("two", 2)
+
+		if want := []Key{"one"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("invalid evicted keys: got = %v, want = %v", got, want)
+		}
+	})
+}
+
+func TestGetMany(t *testing.T) {
+	t.Parallel()
+
+	const cap = 3
+	cache, _ := New(cap)
+	cache.Set("one", 1)
+	cache.Set("two", 2)
+	cache.Set("three", 3)
+
+	got := cache.GetMany([]Key{"two", "absent", "one", "two"})
+	want := []Result{
+		{Key: "two", Value: 2, Found: true},
+		{Key: "absent"},
+		{Key: "one", Value: 1, Found: true},
+		{Key: "two", Value: 2, Found: true},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("invalid results: got = %v, want = %v", got, want)
+	}
+
+	if got := cache.queue.Back().Value.(*listItem).key; got != "three" {
+		t.Errorf("found keys must be promoted: back = %v", got)
+	}
+
+	t.Run("promotion order", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 5
+		cache, _ := New(cap)
+		for _, key := range []Key{"one", "two", "three", "four", "five"} {
+			cache.Set(key, 0)
+		}
+
+		cache.GetMany([]Key{"two", "four", "absent", "one", "four"})
+
+		var got []Key
+		for _, e := range cache.Snapshot() {
+			got = append(got, e.Key)
+		}
+		want := []Key{"four", "one", "two", "five", "three"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("invalid recency order: got = %v, want = %v", got, want)
+		}
+	})
+}
+
+func TestStats(t *testing.T) {
+	t.Run("max used", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 5
+		cache, _ := New(cap)
+
+		steps := []struct {
+			set     int
+			delete  int
+			maxUsed int
+		}{
+			{set: 3, maxUsed: 3},
+			{delete: 2, maxUsed: 3},
+			{set: 1, maxUsed: 3},
+			{set: 2, maxUsed: 4},
+			{set: 10, maxUsed: cap},
+			{delete: cap, maxUsed: cap},
+		}
+
+		n := 0
+		for _, step := range steps {
+			for range step.set {
+				cache.Set(Key(strconv.Itoa(n)), n)
+				n++
+			}
+			for _, key := range cache.items {
+				if step.delete == 0 {
+					break
+				}
+				cache.Delete(key.Value.(*listItem).key)
+				step.delete--
+			}
+
+			if got := cache.Stats().MaxUsed; got != step.maxUsed {
+				t.Errorf("invalid high-watermark: got = %v, want = %v", got, step.maxUsed)
+			}
+		}
+	})
+
+	t.Run("lock wait", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap        = 10
+			goroutines = 4
+			hold       = 10 * time.Millisecond
+		)
+		cache, _ := New(cap, WithLockProfiling())
+
+		var wg sync.WaitGroup
+		cache.mu.Lock()
+		for i := range goroutines {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				cache.Set(Key(strconv.Itoa(i)), i)
+			}()
+		}
+		time.Sleep(hold)
+		cache.mu.Unlock()
+		wg.Wait()
+
+		stats := cache.Stats()
+		if stats.LockWaitAvg <= 0 {
+			t.Errorf("positive average lock wait expected: got = %v", stats.LockWaitAvg)
+		}
+
+		if stats.LockWaitMax < hold/2 {
+			t.Errorf("max lock wait must reflect contention: got = %v, want >= %v", stats.LockWaitMax, hold/2)
+		}
+	})
+
+	t.Run("size and capacity", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap        = 8
+			goroutines = 4
+			ops        = 1000
+		)
+		cache, _ := New(cap)
+
+		if stats := cache.Stats(); stats.Size != 0 || stats.Capacity != cap || stats.Utilization != 0 {
+			t.Errorf("invalid empty cache stats: got = %+v", stats)
+		}
+
+		var wg sync.WaitGroup
+		for i := range goroutines {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := range ops {
+					key := Key(strconv.Itoa(i*ops + j))
+					if j%3 == 0 {
+						cache.Delete(key)
+					} else {
+						cache.Set(key, j)
+					}
+				}
+			}()
+		}
+		for range ops {
+			stats := cache.Stats()
+			if stats.Size > stats.Capacity || stats.Utilization != float64(stats.Size)/float64(stats.Capacity) {
+				t.Fatalf("inconsistent snapshot: got = %+v", stats)
+			}
+		}
+		wg.Wait()
+
+		cache.Resize(cap * 2)
+		if stats := cache.Stats(); stats.Size != cap || stats.Capacity != cap*2 || stats.Utilization != 0.5 {
+			t.Errorf("invalid stats after resize: got = %+v", stats)
+		}
+	})
+
+	t.Run("lock profiling disabled", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 10
+		cache, _ := New(cap)
+		cache.Set("one", 1)
+
+		if stats := cache.Stats(); stats.LockWaitAvg != 0 || stats.LockWaitMax != 0 {
+			t.Errorf("lock wait must not be recorded: got = %v", stats)
+		}
+	})
+}
+
+func TestAge(t *testing.T) {
+	t.Run("grows over time", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 2
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		cache, _ := New(cap, WithNowFunc(func() time.Time { return now }))
+		cache.Set("one", 1)
+
+		var want time.Duration
+		for _, step := range []time.Duration{0, time.Second, time.Minute} {
+			now = now.Add(step)
+			want += step
+			if got, ok := cache.Age("one"); !ok || got != want {
+				t.Errorf("got = %v, want = %v", got, want)
+			}
+		}
+	})
+
+	t.Run("survives promotion and update", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 2
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		cache, _ := New(cap, WithNowFunc(func() time.Time { return now }))
+		cache.Set("one", 1)
+
+		now = now.Add(time.Minute)
+		cache.Get("one")
+		cache.Set("one", 2)
+
+		now = now.Add(time.Second)
+		if got, ok := cache.Age("one"); !ok || got != time.Minute+time.Second {
+			t.Errorf("age must count from the first insert: got = %v, want = %v", got, time.Minute+time.Second)
+		}
+
+		if got, ok := cache.SinceUpdate("one"); !ok || got != time.Second {
+			t.Errorf("invalid time since update: got = %v, want = %v", got, time.Second)
+		}
+	})
+
+	t.Run("absent key", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 2
+		cache, _ := New(cap)
+
+		if _, ok := cache.Age("one"); ok {
+			t.Error("false expected")
+		}
+
+		if _, ok := cache.SinceUpdate("one"); ok {
+			t.Error("false expected")
+		}
+	})
+}
+
+func TestDrain(t *testing.T) {
+	t.Parallel()
+
+	const (
+		cap   = 3
+		ttl   = 20 * time.Second
+		ticks = 2
+	)
+	cache, _ := New(cap, WithTTL(ttl, ticks))
+	defer cache.cancel()
+
+	cache.Set("one", 1)
+	cache.Set("two", 2)
+	cache.Set("three", 3)
+
+	got := cache.Drain()
+
+	want := []Key{"three", "two", "one"}
+	if len(got) != len(want) {
+		t.Fatalf("invalid entries: got = %v, want keys = %v", got, want)
+	}
+	for i, entry := range got {
+		if entry.Key != want[i] {
+			t.Errorf("invalid entry order: got = %v, want = %v", entry.Key, want[i])
+		}
+		if time.Until(entry.ExpiresAt) <= 0 {
+			t.Errorf("expiration wasn't returned: got = %v", entry.ExpiresAt)
+		}
+	}
+
+	if cache.Len() != 0 || cache.queue.Len() != 0 {
+		t.Error("cache isn't empty")
+	}
+
+	if cache.ttl != ttl {
+		t.Error("ttl checks must keep running")
+	}
+}
+
+func TestDefaultEvictionPolicy(t *testing.T) {
+	t.Parallel()
+
+	const cap = 3
+	cache, _ := New(cap)
+
+	if _, ok := cache.evictor.(*lruPolicy); !ok {
+		t.Errorf("lru policy expected: got = %T", cache.evictor)
+	}
+
+	cache.Set("one", 1)
+	cache.Set("two", 2)
+	cache.Set("three", 3)
+	cache.Get("one")
+	cache.Set("two", "TWO")
+	cache.Set("four", 4)
+
+	var got []Key
+	for node := cache.queue.Front(); node != nil; node = node.Next() {
+		got = append(got, node.Value.(*listItem).key)
+	}
+
+	if want := []Key{"four", "two", "one"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("invalid recency order: got = %v, want = %v", got, want)
+	}
+}
+
+func TestWithOnExpire(t *testing.T) {
+	cases := []struct {
+		name    string
+		cleaner bool
+	}{
+		{
+			"background cleaner",
+			true,
+		},
+		{
+			"manual delete",
+			false,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			const (
+				cap   = 4
+				ttl   = 50 * time.Millisecond
+				ticks = 4
+			)
+
+			var (
+				mu    sync.Mutex
+				cache *LRUCache
+				got   = make(map[Key]int)
+			)
+			cache, _ = New(cap, WithTTL(ttl, ticks), WithOnExpire(func(key Key, value any) {
+				// the lock is released before the callback
+				cache.Contains(key)
+
+				mu.Lock()
+				defer mu.Unlock()
+				got[key]++
+			}))
+			if !tt.cleaner {
+				cache.cancel()
+			}
+			defer cache.cancel()
+
+			for i := range cap {
+				cache.Set(Key(strconv.Itoa(i)), i)
+			}
+			time.Sleep(ttl * 3)
+			cache.DeleteExpired()
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if len(got) != cap {
+				t.Errorf("callback must fire for each expired key: got = %v", got)
+			}
+
+			for key, n := range got {
+				if n != 1 {
+					t.Errorf("callback must fire once for key %v: got = %v", key, n)
+				}
+			}
+		})
+	}
+}
+
+func TestWithNowFunc(t *testing.T) {
+	t.Parallel()
+
+	const (
+		cap   = 2
+		ttl   = time.Minute
+		ticks = 2
+	)
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache, _ := New(cap, WithTTL(ttl, ticks), WithNowFunc(func() time.Time { return now }))
+	cache.cancel()
+
+	cache.Set("one", 1)
+
+	if got, want := cache.items["one"].Value.(*listItem).expiresAt, now.Add(ttl); !got.Equal(want) {
+		t.Errorf("invalid expiresAt: got = %v, want = %v", got, want)
+	}
+
+	now = now.Add(ttl / 2)
+	cache.DeleteExpired()
+
+	if !cache.Contains("one") {
+		t.Error("element expired too early")
+	}
+
+	now = now.Add(ttl)
+	cache.DeleteExpired()
+
+	if cache.Contains("one") {
+		t.Error("element must expire")
+	}
+}
+
+func TestSetWithExpiry(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name  string
+		at    time.Time
+		exist bool
+	}{
+		{
+			"future deadline",
+			now.Add(time.Minute),
+			true,
+		},
+		{
+			"past deadline",
+			now.Add(-time.Minute),
+			false,
+		},
+		{
+			"zero deadline",
+			time.Time{},
+			true,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			const (
+				cap   = 2
+				ttl   = time.Second
+				ticks = 2
+			)
+
+			clock := now
+			cache, _ := New(cap, WithTTL(ttl, ticks), WithNowFunc(func() time.Time { return clock }))
+			cache.cancel()
+
+			cache.Set("one", 1)
+			cache.SetWithExpiry("one", "ONE", tt.at)
+
+			value, exist := cache.Get("one")
+			if exist != tt.exist {
+				t.Fatalf("invalid presence: got = %v, want = %v", exist, tt.exist)
+			}
+			if !exist {
+				return
+			}
+
+			if value != "ONE" {
+				t.Errorf("invalid value: got = %v, want = %v", value, "ONE")
+			}
+
+			if got := cache.items["one"].Value.(*listItem).expiresAt; !got.Equal(tt.at) {
+				t.Errorf("access must not refresh expiration: got = %v, want = %v", got, tt.at)
+			}
+
+			// global ttl has passed, the deadline hasn't
+			clock = clock.Add(2 * ttl)
+			if _, exist := cache.Get("one"); !exist {
+				t.Error("element must live until deadline")
+			}
+
+			clock = clock.Add(time.Minute)
+			cache.DeleteExpired()
+			if _, exist := cache.Get("one"); exist != tt.at.IsZero() {
+				t.Errorf("invalid presence after deadline: got = %v", exist)
+			}
+		})
+	}
+}
+
+func TestWarm(t *testing.T) {
+	t.Parallel()
+
+	const cap = 3
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache, _ := New(cap, WithNowFunc(func() time.Time { return now }))
+
+	entries := []Entry{
+		{Key: "one", Value: 1},
+		{Key: "two", Value: 2},
+		{Key: "expired", Value: 0, ExpiresAt: now.Add(-time.Second)},
+		{Key: "three", Value: 3, ExpiresAt: now.Add(time.Minute)},
+		{Key: "four", Value: 4},
+		{Key: "five", Value: 5},
+	}
+	cache.Warm(entries)
+
+	var got []Key
+	for node := cache.queue.Front(); node != nil; node = node.Next() {
+		got = append(got, node.Value.(*listItem).key)
+	}
+
+	if want := []Key{"five", "four", "three"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("invalid surviving keys: got = %v, want = %v", got, want)
+	}
+
+	if got, want := cache.items["three"].Value.(*listItem).expiresAt, now.Add(time.Minute); !got.Equal(want) {
+		t.Errorf("expiration wasn't restored: got = %v, want = %v", got, want)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	t.Parallel()
+
+	const cap = 3
+	cache, _ := New(cap)
+
+	cache.Set("one", 1)
+	cache.Set("two", 2)
+
+	got := cache.Snapshot()
+
+	cache.Set("one", "ONE")
+	cache.Set("three", 3)
+	cache.Delete("two")
+
+	want := []Entry{
+		{Key: "two", Value: 2},
+		{Key: "one", Value: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("snapshot was affected by mutations: got = %v, want = %v", got, want)
+	}
+}
+
+func TestOrderedEntries(t *testing.T) {
+	t.Parallel()
+
+	const cap = 3
+	cache, _ := New(cap)
+
+	if got := cache.OrderedEntries(); len(got) != 0 {
+		t.Errorf("empty cache expected: got = %v", got)
+	}
+
+	cache.Set("one", 1)
+	cache.Set("two", 2)
+	cache.Set("three", 3)
+	cache.Get("one")
+	cache.Set("two", "TWO")
+	cache.Set("four", 4)
+	cache.Peek("one")
+
+	want := []Entry{
+		{Key: "four", Value: 4},
+		{Key: "two", Value: "TWO"},
+		{Key: "one", Value: 1},
+	}
+	if got := cache.OrderedEntries(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got = %v, want = %v", got, want)
+	}
+}
+
+func TestGetInfo(t *testing.T) {
+	const ttl = time.Minute
+
+	cases := []struct {
+		name string
+		set  func(cache *LRUCache, now time.Time)
+		want func(now time.Time) AccessInfo
+	}{
+		{
+			"sliding",
+			func(cache *LRUCache, _ time.Time) { cache.Set("one", 1) },
+			func(now time.Time) AccessInfo { return AccessInfo{Extended: true, ExpiresAt: now.Add(ttl)} },
+		},
+		{
+			"absolute",
+			func(cache *LRUCache, now time.Time) { cache.SetWithExpiry("one", 1, now.Add(ttl)) },
+			func(now time.Time) AccessInfo {
+				return AccessInfo{Absolute: true, ExpiresAt: now.Add(ttl - time.Second)}
+			},
+		},
+		{
+			"no expiration",
+			func(cache *LRUCache, _ time.Time) { cache.SetWithExpiry("one", 1, time.Time{}) },
+			func(time.Time) AccessInfo { return AccessInfo{Absolute: true} },
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			const cap = 2
+			now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+			cache, _ := New(cap, WithNowFunc(func() time.Time { return now }))
+			cache.SetDefaultTTL(ttl)
+
+			tt.set(cache, now)
+			now = now.Add(time.Second)
+
+			value, info, ok := cache.GetInfo("one")
+			if !ok || value != 1 {
+				t.Fatalf("element expected: got = %v, %v", value, ok)
+			}
+
+			if want := tt.want(now); info != want {
+				t.Errorf("got = %+v, want = %+v", info, want)
+			}
+		})
+	}
+
+	t.Run("absent", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 2
+		cache, _ := New(cap)
+
+		if _, info, ok := cache.GetInfo("one"); ok || info != (AccessInfo{}) {
+			t.Errorf("got = %+v, %v", info, ok)
+		}
+	})
+}
+
+func TestGetE(t *testing.T) {
+	const (
+		cap       = 3
+		maxKeyLen = 8
+		ttl       = time.Minute
+	)
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache, _ := New(cap, WithNowFunc(func() time.Time { return now }), WithMaxKeyLen(maxKeyLen))
+	cache.SetWithExpiry("expired", 0, now.Add(ttl))
+	now = now.Add(ttl)
+	cache.Set("one", 1)
+
+	cases := []struct {
+		name  string
+		key   Key
+		value any
+		err   error
+	}{
+		{"found", "one", 1, nil},
+		{"expired", "expired", nil, ErrExpired},
+		{"expired element is deleted", "expired", nil, ErrNotFound},
+		{"absent", "absent", nil, ErrNotFound},
+		{"rejected", "too long key", nil, ErrKeyRejected},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := cache.GetE(tt.key)
+			if value != tt.value || !errors.Is(err, tt.err) {
+				t.Errorf("got = %v, %v, want = %v, %v", value, err, tt.value, tt.err)
+			}
+		})
+	}
+}
+
+func TestGetAllowStale(t *testing.T) {
+	const (
+		cap = 3
+		ttl = time.Minute
+	)
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache, _ := New(cap, WithNowFunc(func() time.Time { return now }))
+	defer cache.Close()
+	cache.SetWithExpiry("stale", "old", now.Add(ttl))
+	now = now.Add(ttl)
+	cache.Set("fresh", "new")
+
+	t.Run("fresh", func(t *testing.T) {
+		value, stale, ok := cache.GetAllowStale("fresh")
+		if !ok || stale || value != "new" {
+			t.Errorf("got = %v, %v, %v, want = new, false, true", value, stale, ok)
+		}
+	})
+
+	t.Run("stale", func(t *testing.T) {
+		value, stale, ok := cache.GetAllowStale("stale")
+		if !ok || !stale || value != "old" {
+			t.Errorf("got = %v, %v, %v, want = old, true, true", value, stale, ok)
+		}
+
+		if _, exist := cache.items["stale"]; !exist {
+			t.Error("stale element must stay in cache")
+		}
+
+		if _, exist := cache.Get("stale"); exist {
+			t.Error("Get must treat stale element as a miss")
+		}
+	})
+
+	t.Run("absent", func(t *testing.T) {
+		value, stale, ok := cache.GetAllowStale("absent")
+		if ok || stale || value != nil {
+			t.Errorf("got = %v, %v, %v, want = <nil>, false, false", value, stale, ok)
+		}
+	})
+}
+
+func TestAll(t *testing.T) {
+	t.Run("order", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 4
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		cache, _ := New(cap, WithNowFunc(func() time.Time { return now }))
+		cache.Set("one", 1)
+		cache.Set("two", 2)
+		cache.SetWithExpiry("expired", 0, now.Add(time.Second))
+		cache.Set("three", 3)
+		now = now.Add(time.Second)
+
+		var got []Entry
+		for key, value := range cache.All() {
+			got = append(got, Entry{Key: key, Value: value})
+		}
+
+		want := []Entry{{Key: "three", Value: 3}, {Key: "two", Value: 2}, {Key: "one", Value: 1}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got = %v, want = %v", got, want)
+		}
+
+		if got := cache.Len(); got != cap {
+			t.Errorf("iteration must not change cache: got length = %v, want = %v", got, cap)
+		}
+	})
+
+	t.Run("early termination", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 4
+		cache, _ := New(cap)
+		cache.Set("one", 1)
+		cache.Set("two", 2)
+		cache.Set("three", 3)
+
+		var got []Key
+		for key := range cache.All() {
+			got = append(got, key)
+			if key == "two" {
+				break
+			}
+		}
+
+		want := []Key{"three", "two"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got = %v, want = %v", got, want)
+		}
+
+		// The lock must be released after break
+		cache.Set("four", 4)
+		if !cache.Contains("four") {
+			t.Error("cache must stay usable")
+		}
+	})
+}
+
+func TestPeekAll(t *testing.T) {
+	t.Parallel()
+
+	const (
+		cap   = 4
+		ttl   = time.Minute
+		ticks = 2
+	)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache, _ := New(cap, WithTTL(ttl, ticks), WithNowFunc(func() time.Time { return now }))
+	cache.cancel()
+
+	cache.Set("one", 1)
+	now = now.Add(time.Second)
+	cache.Set("two", 2)
+	cache.SetWithExpiry("expired", 0, now.Add(time.Second))
+	now = now.Add(time.Second)
+	cache.Set("three", 3)
+
+	before := cache.Snapshot()
+	now = now.Add(time.Second)
+
+	got := cache.PeekAll()
+	want := []Entry{before[0], before[2], before[3]}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got = %v, want = %v", got, want)
+	}
+
+	if after := cache.Snapshot(); !reflect.DeepEqual(after, before) {
+		t.Errorf("recency or expiration was changed: got = %v, want = %v", after, before)
+	}
+
+	if count, _ := cache.AccessCount("one"); count != 0 {
+		t.Errorf("access must not be counted: got = %v", count)
+	}
+}
+
+func TestWithNegativeTTL(t *testing.T) {
+	t.Run("tombstone and value ttl", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap         = 4
+			ttl         = time.Hour
+			negativeTTL = time.Minute
+		)
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		cache, _ := New(cap, WithNegativeTTL(negativeTTL), WithNowFunc(func() time.Time { return now }))
+		cache.SetDefaultTTL(ttl)
+
+		cache.Set("present", 1)
+		if cache.SetMiss("missing") {
+			t.Error("false expected for a new tombstone")
+		}
+
+		now = now.Add(negativeTTL / 2)
+		if value, ok := cache.Get("missing"); !ok || value != Miss {
+			t.Errorf("tombstone expected: got = %v, %v", value, ok)
+		}
+
+		now = now.Add(negativeTTL / 2)
+		if cache.Contains("missing") {
+			t.Error("tombstone must expire on negative ttl regardless of access")
+		}
+
+		if !cache.Contains("present") {
+			t.Error("value must use the positive ttl")
+		}
+
+		now = now.Add(ttl)
+		if cache.Contains("present") {
+			t.Error("value must expire on the positive ttl")
+		}
+	})
+
+	t.Run("replaces value", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap         = 2
+			negativeTTL = time.Minute
+		)
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		cache, _ := New(cap, WithNegativeTTL(negativeTTL), WithNowFunc(func() time.Time { return now }))
+		cache.Set("one", 1)
+
+		if !cache.SetMiss("one") {
+			t.Error("true expected for replaced value")
+		}
+
+		if at, _ := cache.Expiry("one"); !at.Equal(now.Add(negativeTTL)) {
+			t.Errorf("invalid tombstone expiry: got = %v, want = %v", at, now.Add(negativeTTL))
+		}
+	})
+
+	t.Run("default ttl without option", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap = 2
+			ttl = time.Hour
+		)
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		cache, _ := New(cap, WithNowFunc(func() time.Time { return now }))
+		cache.SetDefaultTTL(ttl)
+		cache.SetMiss("one")
+
+		if at, _ := cache.Expiry("one"); !at.Equal(now.Add(ttl)) {
+			t.Errorf("invalid tombstone expiry: got = %v, want = %v", at, now.Add(ttl))
+		}
+	})
+
+	t.Run("invalid ttl", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 2
+		if _, err := New(cap, WithNegativeTTL(0)); err == nil {
+			t.Error("error expected")
+		}
+	})
+}
+
+func TestSetMissWithBackoff(t *testing.T) {
+	t.Run("tombstone ttl grows up to max", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap  = 2
+			base = time.Second
+			max  = 5 * time.Second
+		)
+
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		cache, _ := New(cap, WithMissBackoff(base, max), WithNowFunc(func() time.Time { return now }))
+
+		for _, want := range []time.Duration{base, 2 * base, 4 * base, max, max} {
+			if got := cache.SetMissWithBackoff("one"); got != want {
+				t.Errorf("invalid tombstone ttl: got = %v, want = %v", got, want)
+			}
+
+			if got := cache.items["one"].Value.(*listItem).expiresAt; !got.Equal(now.Add(want)) {
+				t.Errorf("invalid expiresAt: got = %v, want = %v", got, now.Add(want))
+			}
+		}
+
+		if value, exist := cache.Get("one"); !exist || value != Miss {
+			t.Errorf("tombstone expected: got = %v, %v", value, exist)
+		}
+
+		now = now.Add(max)
+		if got := cache.SetMissWithBackoff("one"); got != base {
+			t.Errorf("expired tombstone must start from base: got = %v, want = %v", got, base)
+		}
+	})
+
+	t.Run("tombstone without own ttl", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap  = 2
+			base = time.Second
+			max  = 5 * time.Second
+		)
+		cache, _ := New(cap, WithMissBackoff(base, max))
+		cache.Set("one", Miss)
+		cache.SetMiss("two")
+
+		for _, key := range []Key{"one", "two"} {
+			if got := cache.SetMissWithBackoff(key); got != base {
+				t.Errorf("tombstone must start from base: got = %v, want = %v", got, base)
+			}
+			if !cache.Contains(key) {
+				t.Error("tombstone must be kept")
+			}
+		}
+	})
+
+	t.Run("backoff isn't configured", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 2
+		cache, _ := New(cap)
+
+		if got := cache.SetMissWithBackoff("one"); got != 0 {
+			t.Errorf("zero ttl expected: got = %v", got)
+		}
+
+		if cache.Contains("one") {
+			t.Error("tombstone must not be added")
+		}
+	})
+}
+
+func TestSetDefaultTTL(t *testing.T) {
+	t.Parallel()
+
+	const (
+		cap    = 3
+		ttl    = time.Minute
+		newTTL = time.Hour
+		ticks  = 2
+	)
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache, _ := New(cap, WithTTL(ttl, ticks), WithNowFunc(func() time.Time { return now }))
+	cache.cancel()
+
+	cache.Set("old", 1)
+
+	if err := cache.SetDefaultTTL(newTTL); err != nil {
+		t.Errorf("not expected error = %v", err)
+	}
+
+	cache.Set("new", 2)
+
+	if got, want := cache.items["old"].Value.(*listItem).expiresAt, now.Add(ttl); !got.Equal(want) {
+		t.Errorf("existing element expiration must be kept: got = %v, want = %v", got, want)
+	}
+
+	if got, want := cache.items["new"].Value.(*listItem).expiresAt, now.Add(newTTL); !got.Equal(want) {
+		t.Errorf("new element must get new ttl: got = %v, want = %v", got, want)
+	}
+
+	if err := cache.SetDefaultTTL(0); err != nil {
+		t.Errorf("not expected error = %v", err)
+	}
+
+	cache.Set("eternal", 3)
+
+	if got := cache.items["eternal"].Value.(*listItem).expiresAt; !got.IsZero() {
+		t.Errorf("zero ttl must disable expiration: got = %v", got)
+	}
+
+	if err := cache.SetDefaultTTL(-time.Second); err == nil {
+		t.Error("error expected")
+	}
+}
+
+func TestExpiredCount(t *testing.T) {
+	t.Run("cleaner lag", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap   = 4
+			ttl   = time.Minute
+			ticks = 2
+			count = 3
+		)
+
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		cache, _ := New(cap, WithTTL(ttl, ticks), WithNowFunc(func() time.Time { return now }))
+		cache.cancel()
+
+		for i := 0; i < count; i++ {
+			cache.Set(Key(strconv.Itoa(i)), i)
+		}
+		cache.SetWithExpiry("eternal", 0, time.Time{})
+
+		if got := cache.ExpiredCount(); got != 0 {
+			t.Errorf("no expired elements expected: got = %v, want = %v", got, 0)
+		}
+
+		now = now.Add(ttl)
+		if got := cache.ExpiredCount(); got != count {
+			t.Errorf("invalid expired count: got = %v, want = %v", got, count)
+		}
+
+		if got, want := cache.Len(), count+1; got != want {
+			t.Errorf("counting must not delete elements: got = %v, want = %v", got, want)
+		}
+	})
+
+	t.Run("ttl disabled", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 2
+		cache, _ := New(cap)
+		cache.Set("one", 1)
+
+		if got := cache.ExpiredCount(); got != 0 {
+			t.Errorf("got = %v, want = %v", got, 0)
+		}
+	})
+}
+
+func TestExpireAllIn(t *testing.T) {
+	t.Run("within window", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap     = 4
+			ttl     = 100 * time.Millisecond
+			ticks   = 10
+			window  = ttl / 2
+			timeout = time.Second
+		)
+
+		var mu sync.Mutex
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		cache, _ := New(cap, WithTTL(ttl, ticks), WithNowFunc(func() time.Time {
+			mu.Lock()
+			defer mu.Unlock()
+			return now
+		}))
+		defer cache.Close()
+
+		cache.Set("one", 1)
+		cache.SetWithExpiry("eternal", 0, time.Time{})
+		cache.SetWithExpiry("soon", 0, now.Add(window/2))
+
+		cache.ExpireAllIn(window)
+
+		for key, want := range map[Key]time.Time{"one": now.Add(window), "eternal": now.Add(window), "soon": now.Add(window / 2)} {
+			if got, _ := cache.Expiry(key); !got.Equal(want) {
+				t.Errorf("invalid expiration of %v: got = %v, want = %v", key, got, want)
+			}
+		}
+
+		cache.Get("one")
+		if got, _ := cache.Expiry("one"); !got.Equal(now.Add(window)) {
+			t.Errorf("access must not extend expiration: got = %v", got)
+		}
+
+		time.Sleep(2 * ttl)
+		if got := cache.Len(); got != 3 {
+			t.Errorf("elements must be kept until the window ends: got = %v, want = %v", got, 3)
+		}
+
+		mu.Lock()
+		now = now.Add(window)
+		mu.Unlock()
+
+		deadline := time.Now().Add(timeout)
+		for cache.Len() != 0 {
+			if time.Now().After(deadline) {
+				t.Fatal("elements must be swept after the window")
+			}
+			time.Sleep(ttl / ticks)
+		}
+	})
+}
+
+func TestTTLHistogram(t *testing.T) {
+	t.Run("varied expiries", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 10
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		cache, _ := New(cap, WithNowFunc(func() time.Time { return now }))
+
+		expiries := map[Key]time.Duration{
+			"1s":  time.Second,
+			"10s": 10 * time.Second,
+			"30s": 30 * time.Second,
+			"1m":  time.Minute,
+			"59m": 59 * time.Minute,
+			"2h":  2 * time.Hour,
+			"3h":  3 * time.Hour,
+		}
+		for key, ttl := range expiries {
+			cache.SetWithExpiry(key, 0, now.Add(ttl))
+		}
+		cache.Set("eternal", 0)
+
+		buckets := []time.Duration{10 * time.Second, time.Minute, time.Hour}
+		want := []int{2, 2, 1, 2}
+		if got := cache.TTLHistogram(buckets); !reflect.DeepEqual(got, want) {
+			t.Errorf("got = %v, want = %v", got, want)
+		}
+
+		now = now.Add(5 * time.Minute)
+		want = []int{4, 0, 1, 2}
+		if got := cache.TTLHistogram(buckets); !reflect.DeepEqual(got, want) {
+			t.Errorf("expired element must fall into the first bucket: got = %v, want = %v", got, want)
+		}
+	})
+
+	t.Run("ttl disabled", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 2
+		cache, _ := New(cap)
+		cache.Set("one", 1)
+
+		want := []int{0, 0}
+		if got := cache.TTLHistogram([]time.Duration{time.Minute}); !reflect.DeepEqual(got, want) {
+			t.Errorf("got = %v, want = %v", got, want)
+		}
+	})
+}
+
+func TestNextExpiry(t *testing.T) {
+	t.Run("differing expiry times", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap   = 4
+			ttl   = time.Minute
+			ticks = 2
+		)
+
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		cache, _ := New(cap, WithTTL(ttl, ticks), WithNowFunc(func() time.Time { return now }))
+		cache.cancel()
+
+		cache.Set("one", 1)
+		now = now.Add(time.Second)
+		cache.Set("two", 2)
+		cache.SetWithExpiry("eternal", 0, time.Time{})
+		now = now.Add(time.Second)
+		cache.Get("one")
+
+		key, at, ok := cache.NextExpiry()
+		if !ok {
+			t.Fatal("true expected")
+		}
+
+		if want := now.Add(ttl - time.Second); key != "two" || !at.Equal(want) {
+			t.Errorf("invalid next expiry: got = %v %v, want = %v %v", key, at, "two", want)
+		}
+	})
+
+	t.Run("ttl disabled", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 2
+		cache, _ := New(cap)
+
+		if _, _, ok := cache.NextExpiry(); ok {
+			t.Error("false expected for empty cache")
+		}
+
+		cache.Set("one", 1)
+
+		if _, _, ok := cache.NextExpiry(); ok {
+			t.Error("false expected without ttl")
+		}
+	})
+}
+
+func TestExpiryIndex(t *testing.T) {
+	t.Parallel()
+
+	const (
+		cap   = 4
+		ttl   = time.Minute
+		ticks = 2
+	)
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	start := now
+	cache, _ := New(cap, WithTTL(ttl, ticks), WithNowFunc(func() time.Time { return now }))
+	cache.cancel()
+
+	cache.Set("refreshed", 1)
+	cache.Set("stale", 2)
+	now = now.Add(30 * time.Second)
+	cache.Get("refreshed")
+	cache.SetWithExpiry("short", 3, now.Add(10*time.Second))
+
+	// recency order: short, refreshed, stale
+	// expiration order: short, stale, refreshed
+	now = start.Add(ttl + 5*time.Second)
+	cache.DeleteExpired()
+
+	for _, key := range []Key{"short", "stale"} {
+		if _, exist := cache.items[key]; exist {
+			t.Errorf("expired key %v wasn't deleted", key)
+		}
+	}
+
+	if _, exist := cache.items["refreshed"]; !exist {
+		t.Error("refreshed key must be kept")
+	}
+
+	if got, want := len(cache.expiry), len(cache.items); got != want {
+		t.Errorf("expiry index is out of sync: got = %v, want = %v", got, want)
+	}
+}
+
+func TestClearExpiredInterleaved(t *testing.T) {
+	const (
+		cap   = 4
+		ttl   = time.Minute
+		ticks = 2
+	)
+
+	cases := []struct {
+		name    string
+		options []Option
+		fill    func(cache *LRUCache, now *time.Time)
+		expired []Key
+		kept    []Key
+	}{
+		{
+			"access refreshes without reordering",
+			[]Option{WithEvictionPolicy(PolicyFIFO)},
+			func(cache *LRUCache, now *time.Time) {
+				cache.Set("fresh", 1)
+				cache.Set("one", 2)
+				cache.Set("two", 3)
+				*now = now.Add(30 * time.Second)
+				cache.Get("fresh")
+				*now = now.Add(35 * time.Second)
+			},
+			[]Key{"one", "two"},
+			[]Key{"fresh"},
+		},
+		{
+			"ttl shortened",
+			nil,
+			func(cache *LRUCache, now *time.Time) {
+				cache.Set("fresh", 1)
+				cache.SetDefaultTTL(time.Second)
+				cache.Set("one", 2)
+				cache.SetDefaultTTL(ttl)
+				cache.Set("two", 3)
+				cache.SetDefaultTTL(time.Second)
+				cache.Set("three", 4)
+				*now = now.Add(2 * time.Second)
+			},
+			[]Key{"one", "three"},
+			[]Key{"fresh", "two"},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+			options := append([]Option{WithTTL(ttl, ticks), WithNowFunc(func() time.Time { return now })}, tt.options...)
+			cache, _ := New(cap, options...)
+			cache.cancel()
+
+			tt.fill(cache, &now)
+			clearExpired(cache)
+
+			for _, key := range tt.expired {
+				if _, exist := cache.items[key]; exist {
+					t.Errorf("expired key %v was left behind", key)
+				}
+			}
+
+			for _, key := range tt.kept {
+				if _, exist := cache.items[key]; !exist {
+					t.Errorf("fresh key %v must be kept", key)
+				}
+			}
+		})
+	}
+}
+
+func TestWithCleanupBatchSize(t *testing.T) {
+	t.Parallel()
+
+	const (
+		cap       = 100
+		batchSize = 10
+		ttl       = time.Minute
+		ticks     = 2
+	)
+
+	var (
+		cache *LRUCache
+		sizes = make(map[int]bool)
+	)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache, _ = New(cap,
+		WithTTL(ttl, ticks),
+		WithNowFunc(func() time.Time { return now }),
+		WithCleanupBatchSize(batchSize),
+		// callbacks run between batches when the lock is released
+		WithOnExpire(func(Key, any) { sizes[cache.Len()] = true }),
+	)
+	cache.cancel()
+
+	for i := range cap {
+		cache.Set(Key(strconv.Itoa(i)), i)
+	}
+	now = now.Add(ttl)
+	cache.DeleteExpired()
+
+	if got := cache.Len(); got != 0 {
+		t.Errorf("all expired elements must be cleared: got = %v", got)
+	}
+
+	if got, want := len(sizes), cap/batchSize; got != want {
+		t.Errorf("invalid number of batches: got = %v, want = %v", got, want)
+	}
+
+	for size := range sizes {
+		if size%batchSize != 0 {
+			t.Errorf("batch exceeds batch size: cache size between batches = %v", size)
+		}
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	t.Parallel()
+
+	const (
+		cap   = 2
+		ttl   = time.Minute
+		ticks = 2
+	)
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache, _ := New(cap, WithTTL(ttl, ticks), WithNowFunc(func() time.Time { return now }))
+	cache.cancel()
+
+	cache.Set("one", 1)
+	cache.Set("two", 2)
+	now = now.Add(time.Second)
+
+	if !cache.Refresh("one") {
+		t.Error("true expected for present key")
+	}
+
+	item := cache.queue.Front().Value.(*listItem)
+	if item.key != "one" {
+		t.Errorf("element wasn't promoted: front = %v", item.key)
+	}
+
+	if got, want := item.expiresAt, now.Add(ttl); !got.Equal(want) {
+		t.Errorf("expiresAt wasn't extended: got = %v, want = %v", got, want)
+	}
+
+	if cache.Refresh("absent") {
+		t.Error("false expected for absent key")
+	}
+
+	if cache.Contains("absent") {
+		t.Error("absent key must not be added")
+	}
+}
+
+func TestWithTTLResolution(t *testing.T) {
+	t.Run("wakes near expiry", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap        = 4
+			resolution = time.Minute
+		)
+
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		cache, _ := New(cap, WithNowFunc(func() time.Time { return now }), WithTTLResolution(resolution))
+
+		if _, ok := cache.nextCleanDelay(); ok {
+			t.Error("idle cleaner must wait without timer")
+		}
+
+		cache.SetWithExpiry("one", 1, now.Add(10*time.Minute))
+		if got, ok := cache.nextCleanDelay(); !ok || got != 10*time.Minute {
+			t.Errorf("cleaner must wake at the first expiry: got = %v, want = %v", got, 10*time.Minute)
+		}
+
+		cache.SetWithExpiry("two", 2, now.Add(time.Second))
+		if got, ok := cache.nextCleanDelay(); !ok || got != resolution {
+			t.Errorf("cleaner must not wake more often than resolution: got = %v, want = %v", got, resolution)
+		}
+	})
+
+	t.Run("sweeps on time", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap        = 4
+			ttl        = time.Hour
+			ticks      = 2
+			resolution = 10 * time.Millisecond
+			expiry     = 50 * time.Millisecond
+			timeout    = time.Second
+		)
+
+		expired := make(chan time.Time, 1)
+		cache, _ := New(cap, WithTTLResolution(resolution), WithTTL(ttl, ticks), WithOnExpire(func(Key, any) {
+			expired <- time.Now()
+		}))
+		defer cache.Close()
+
+		// The cleaner sleeps without timer until the element is added
+		time.Sleep(resolution)
+		at := time.Now().Add(expiry)
+		cache.SetWithExpiry("one", 1, at)
+
+		select {
+		case swept := <-expired:
+			if late := swept.Sub(at); late > expiry {
+				t.Errorf("element swept too late: got = %v after expiry", late)
+			}
+		case <-time.After(timeout):
+			t.Fatal("element wasn't swept near its expiry")
+		}
+	})
+
+	t.Run("invalid resolution", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 2
+		if _, err := New(cap, WithTTLResolution(0)); err == nil {
+			t.Error("error expected")
+		}
+	})
+}
+
+func TestCompact(t *testing.T) {
+	cases := []struct {
+		name   string
+		policy Policy
+	}{
+		{"lru", PolicyLRU},
+		{"random", PolicyRandom},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			const (
+				count = 10000
+				keep  = 3
+				ttl   = time.Hour
+			)
+			now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+			cache, _ := New(count, WithEvictionPolicy(tt.policy), WithNowFunc(func() time.Time { return now }))
+			for i := range count {
+				cache.SetWithExpiry(IntKey(i), i, now.Add(ttl))
+			}
+			for i := keep; i < count; i++ {
+				cache.Delete(IntKey(i))
+			}
+
+			want := cache.OrderedEntries()
+			cache.Compact()
+
+			if got := cache.OrderedEntries(); !reflect.DeepEqual(got, want) {
+				t.Errorf("got = %v, want = %v", got, want)
+			}
+			if got := cap(cache.expiry); got != keep {
+				t.Errorf("expiry heap must be right-sized: got capacity = %v, want = %v", got, keep)
+			}
+			if err := cache.Validate(); err != nil {
+				t.Errorf("got = %v, want = <nil>", err)
+			}
+
+			cache.Set("new", 0)
+			if got := cache.Len(); got != keep+1 {
+				t.Errorf("got length = %v, want = %v", got, keep+1)
+			}
+		})
+	}
+}
+
+func TestForceEvict(t *testing.T) {
+	cases := []struct {
+		name    string
+		n       int
+		evicted []Key
+		kept    []Key
+	}{
+		{"fewer than size", 2, []Key{"one", "two"}, []Key{"three"}},
+		{"equal to size", 3, []Key{"one", "two", "three"}, nil},
+		{"more than size", 5, []Key{"one", "two", "three"}, nil},
+		{"zero", 0, nil, []Key{"three", "two", "one"}},
+		{"negative", -1, nil, []Key{"three", "two", "one"}},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			const cap = 5
+			var evicted []Key
+			cache, _ := New(cap, WithOnEvict(func(key Key, _ any, reason EvictReason) {
+				if reason != EvictManual {
+					t.Errorf("invalid reason: got = %v, want = %v", reason, EvictManual)
+				}
+				evicted = append(evicted, key)
+			}))
+			cache.Set("one", 1)
+			cache.Set("two", 2)
+			cache.Set("three", 3)
+
+			if got := cache.ForceEvict(tt.n); got != len(tt.evicted) {
+				t.Errorf("invalid evicted count: got = %v, want = %v", got, len(tt.evicted))
+			}
+
+			if !reflect.DeepEqual(evicted, tt.evicted) {
+				t.Errorf("invalid evicted keys: got = %v, want = %v", evicted, tt.evicted)
+			}
+
+			var kept []Key
+			for _, e := range cache.Snapshot() {
+				kept = append(kept, e.Key)
+			}
+			if !reflect.DeepEqual(kept, tt.kept) {
+				t.Errorf("invalid kept keys: got = %v, want = %v", kept, tt.kept)
+			}
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	t.Run("small cache", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap   = 10
+			ttl   = 5 * time.Second
+			ticks = 2
+		)
+		cache, _ := New(cap, WithTTL(ttl, ticks))
+		defer cache.Close()
+
+		cache.Set("k3", 3)
+		cache.Set("k2", 2)
+		cache.Set("k1", 1)
+
+		want := "LRUCache(size=3/10, ttl=5s) [k1 k2 k3]"
+		if got := cache.String(); got != want {
+			t.Errorf("got = %q, want = %q", got, want)
+		}
+	})
+
+	t.Run("large cache is truncated", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap   = 1000
+			count = 100
+		)
+		cache, _ := New(cap)
+		for i := range count {
+			cache.Set(Key(strconv.Itoa(i)), i)
+		}
+
+		want := "LRUCache(size=100/1000, ttl=0s) [99 98 97 96 95 94 93 92 91 90 ...+90]"
+		if got := cache.String(); got != want {
+			t.Errorf("got = %q, want = %q", got, want)
+		}
+	})
+}
+
+func TestWithEvictionLowWatermark(t *testing.T) {
+	t.Run("batch eviction", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap      = 10
+			fraction = 0.5
+		)
+		var evicted []Key
+		cache, _ := New(cap, WithEvictionLowWatermark(fraction), WithOnEvict(func(key Key, _ any, _ EvictReason) {
+			evicted = append(evicted, key)
+		}))
+
+		for i := range cap {
+			cache.Set(Key(strconv.Itoa(i)), i)
+		}
+		cache.Set("overflow", 0)
+
+		if got, want := cache.Len(), cap/2+1; got != want {
+			t.Errorf("size must drop to low watermark: got = %v, want = %v", got, want)
+		}
+
+		want := []Key{"0", "1", "2", "3", "4"}
+		if !reflect.DeepEqual(evicted, want) {
+			t.Errorf("invalid evicted keys: got = %v, want = %v", evicted, want)
+		}
+
+		for i := range cap/2 - 1 {
+			cache.Set(Key("refill"+strconv.Itoa(i)), i)
+		}
+		if got := cache.Len(); got != cap || len(evicted) != len(want) {
+			t.Errorf("cache must refill without eviction: got size = %v, evictions = %v", got, len(evicted))
+		}
+	})
+
+	t.Run("invalid fraction", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 2
+		for _, fraction := range []float64{0, 1, -0.5, 1.5} {
+			if _, err := New(cap, WithEvictionLowWatermark(fraction)); err == nil {
+				t.Errorf("error expected for %v", fraction)
+			}
+		}
+	})
+}
+
+func TestWithEvictionSlack(t *testing.T) {
+	t.Run("temporary over capacity", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap   = 4
+			slack = 3
+		)
+		var evicted []Key
+		cache, _ := New(cap, WithEvictionSlack(slack), WithOnEvict(func(key Key, _ any, _ EvictReason) {
+			evicted = append(evicted, key)
+		}))
+
+		for i := range cap + slack {
+			cache.Set(Key(strconv.Itoa(i)), i)
+		}
+		if got := cache.Len(); got != cap+slack || len(evicted) != 0 {
+			t.Errorf("cache must grow up to cap + slack without eviction: got size = %v, evictions = %v", got, len(evicted))
+		}
+
+		cache.Set("trigger", 0)
+		if got := cache.Len(); got != cap {
+			t.Errorf("cache must be trimmed to capacity: got = %v, want = %v", got, cap)
+		}
+
+		want := []Key{"0", "1", "2", "3"}
+		if !reflect.DeepEqual(evicted, want) {
+			t.Errorf("least recently used elements must be evicted: got = %v, want = %v", evicted, want)
+		}
+
+		if !cache.Contains("trigger") {
+			t.Error("new element must be kept")
+		}
+	})
+
+	t.Run("SetWithResult", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap   = 2
+			slack = 2
+		)
+		cache, _ := New(cap, WithEvictionSlack(slack))
+		for i := range cap + slack {
+			if got := cache.SetWithResult(IntKey(i), i); got != (SetResult{Inserted: true}) {
+				t.Errorf("cache must grow up to cap + slack without eviction: got = %+v", got)
+			}
+		}
+
+		want := SetResult{Inserted: true, Evicted: true, EvictedKey: IntKey(0), EvictedCount: slack + 1}
+		if got := cache.SetWithResult("trigger", 0); got != want {
+			t.Errorf("got = %+v, want = %+v", got, want)
+		}
+		if got := cache.Len(); got != cap {
+			t.Errorf("cache must be trimmed to capacity: got = %v, want = %v", got, cap)
+		}
+	})
+
+	t.Run("invalid slack", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 2
+		if _, err := New(cap, WithEvictionSlack(0)); err == nil {
+			t.Error("error expected")
+		}
+	})
+}
+
+func TestWithLoadFactor(t *testing.T) {
+	t.Run("eviction starts at load factor", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap        = 10
+			loadFactor = 0.8
+			limit      = 8
+		)
+		var evicted []Key
+		cache, _ := New(cap, WithLoadFactor(loadFactor), WithOnEvict(func(key Key, _ any, _ EvictReason) {
+			evicted = append(evicted, key)
+		}))
+
+		for i := range limit {
+			cache.Set(IntKey(i), i)
+		}
+		if got := cache.Len(); got != limit || len(evicted) != 0 {
+			t.Errorf("cache must fill up to load factor without eviction: got size = %v, evictions = %v", got, len(evicted))
+		}
+
+		cache.Set("next", 0)
+		if got := cache.Len(); got != limit {
+			t.Errorf("got = %v, want = %v", got, limit)
+		}
+
+		want := []Key{IntKey(0)}
+		if !reflect.DeepEqual(evicted, want) {
+			t.Errorf("least recently used element must be evicted: got = %v, want = %v", evicted, want)
+		}
+	})
+
+	t.Run("full at load factor", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap        = 10
+			loadFactor = 0.5
+			limit      = 5
+		)
+		cache, _ := New(cap, WithLoadFactor(loadFactor))
+		for i := range limit {
+			cache.Set(IntKey(i), i)
+		}
+
+		if !cache.IsFull() {
+			t.Error("cache must be full at load factor")
+		}
+
+		want := SetResult{Inserted: true, Evicted: true, EvictedKey: IntKey(0), EvictedCount: 1}
+		if got := cache.SetWithResult("new", 0); got != want {
+			t.Errorf("got = %+v, want = %+v", got, want)
+		}
+	})
+
+	t.Run("auto tuning", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap        = 4
+			loadFactor = 0.5
+			limit      = 2
+			maxCap     = 8
+			window     = 4
+		)
+		cache, _ := New(cap, WithLoadFactor(loadFactor), WithAutoTune(0.5, maxCap, window))
+		for i := range limit {
+			cache.Set(IntKey(i), i)
+		}
+		for i := range window {
+			cache.Get(IntKey(limit + i))
+		}
+
+		if got := cache.Stats().Capacity; got != 2*cap {
+			t.Errorf("capacity must grow when full at load factor: got = %v, want = %v", got, 2*cap)
+		}
+	})
+
+	t.Run("invalid load factor", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 2
+		for _, f := range []float64{0, 1.5} {
+			if _, err := New(cap, WithLoadFactor(f)); err == nil {
+				t.Errorf("error expected for %v", f)
+			}
+		}
+	})
+}
+
+func TestWithInitialEntries(t *testing.T) {
+	t.Run("within capacity", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap   = 3
+			ttl   = time.Minute
+			ticks = 2
+		)
+		entries := map[Key]any{"one": 1, "two": 2}
+		cache, _ := New(cap, WithInitialEntries(entries), WithTTL(ttl, ticks))
+		defer cache.Close()
+
+		for key, want := range entries {
+			if got, ok := cache.Peek(key); !ok || got != want {
+				t.Errorf("got = %v, want = %v", got, want)
+			}
+			if at, ok := cache.Expiry(key); !ok || at.IsZero() {
+				t.Errorf("ttl must apply to %v", key)
+			}
+		}
+	})
+
+	t.Run("beyond capacity", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap   = 3
+			count = 10
+		)
+		entries := make(map[Key]any, count)
+		for i := range count {
+			entries[Key(strconv.Itoa(i))] = i
+		}
+		var evictions int
+		cache, _ := New(cap, WithInitialEntries(entries), WithOnEvict(func(Key, any, EvictReason) { evictions++ }))
+
+		if got := cache.Len(); got != cap {
+			t.Errorf("invalid length: got = %v, want = %v", got, cap)
+		}
+
+		for _, e := range cache.Snapshot() {
+			if entries[e.Key] != e.Value {
+				t.Errorf("unexpected entry: %v", e)
+			}
+		}
+
+		if evictions != count-cap {
+			t.Errorf("invalid number of evictions: got = %v, want = %v", evictions, count-cap)
+		}
+	})
+}
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		name    string
+		corrupt func(*LRUCache)
+		valid   bool
+	}{
+		{
+			name:  "healthy",
+			valid: true,
+		},
+		{
+			name:    "dangling hash table entry",
+			corrupt: func(l *LRUCache) { l.items["ghost"] = l.items["one"] },
+		},
+		{
+			name:    "element missing from hash table",
+			corrupt: func(l *LRUCache) { l.items["one"] = l.queue.PushBack(&listItem{key: "one"}) },
+		},
+		{
+			name:    "element missing from queue",
+			corrupt: func(l *LRUCache) { l.queue.Remove(l.items["one"]) },
+		},
+		{
+			name:    "mismatched key",
+			corrupt: func(l *LRUCache) { l.items["one"], l.items["two"] = l.items["two"], l.items["one"] },
+		},
+		{
+			name:    "expiry heap out of sync",
+			corrupt: func(l *LRUCache) { l.expiry[0].heapIdx = 1 },
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			const cap = 3
+			now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+			cache, _ := New(cap, WithNowFunc(func() time.Time { return now }))
+			cache.Set("one", 1)
+			cache.Set("two", 2)
+			cache.SetWithExpiry("three", 3, now.Add(time.Minute))
+
+			if tt.corrupt != nil {
+				tt.corrupt(cache)
+			}
+
+			if err := cache.Validate(); (err == nil) != tt.valid {
+				t.Errorf("got = %v, want valid = %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestStartCleaner(t *testing.T) {
+	t.Run("restart after close", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap     = 2
+			ttl     = 20 * time.Millisecond
+			ticks   = 2
+			timeout = time.Second
+		)
+
+		var mu sync.Mutex
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		cache, _ := New(cap, WithTTL(ttl, ticks), WithNowFunc(func() time.Time {
+			mu.Lock()
+			defer mu.Unlock()
+			return now
+		}))
+		defer cache.Close()
+
+		if err := cache.StartCleaner(); err == nil {
+			t.Error("error expected for running cleaner")
+		}
+
+		cache.Close()
+		cache.Set("one", 1)
+
+		if err := cache.StartCleaner(); err != nil {
+			t.Fatalf("not expected error = %v", err)
+		}
+
+		mu.Lock()
+		now = now.Add(ttl)
+		mu.Unlock()
+
+		deadline := time.Now().Add(timeout)
+		for cache.Len() != 0 {
+			if time.Now().After(deadline) {
+				t.Fatal("expired element wasn't swept by the restarted cleaner")
+			}
+			time.Sleep(ttl / ticks)
+		}
+	})
+
+	t.Run("ttl disabled", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 2
+		cache, _ := New(cap)
+
+		if err := cache.StartCleaner(); err == nil {
+			t.Error("error expected")
+		}
+	})
+}
+
+func TestPauseCleaner(t *testing.T) {
+	t.Parallel()
+
+	const (
+		cap     = 2
+		ttl     = 20 * time.Millisecond
+		ticks   = 2
+		timeout = time.Second
+	)
+
+	var mu sync.Mutex
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache, _ := New(cap, WithTTL(ttl, ticks), WithNowFunc(func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}))
+	defer cache.Close()
+
+	cache.PauseCleaner()
+	cache.Set("one", 1)
+	cache.Set("two", 2)
+	mu.Lock()
+	now = now.Add(ttl)
+	mu.Unlock()
+
+	time.Sleep(3 * ttl)
+	if got := cache.ExpiredCount(); got != 2 {
+		t.Errorf("paused cleaner must not sweep: got expired = %v, want = %v", got, 2)
+	}
+
+	select {
+	case <-cache.done:
+		t.Fatal("paused cleaner must keep running")
+	default:
+	}
+
+	cache.ResumeCleaner()
+	deadline := time.Now().Add(timeout)
+	for cache.Len() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expired elements weren't swept after resume")
+		}
+		time.Sleep(ttl / ticks)
+	}
+}
+
+func TestWithTTLPaused(t *testing.T) {
+	t.Parallel()
+
+	const (
+		cap     = 2
+		ttl     = 20 * time.Millisecond
+		ticks   = 2
+		timeout = time.Second
+	)
+
+	var mu sync.Mutex
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache, _ := New(cap, WithTTLPaused(ttl, ticks), WithNowFunc(func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}))
+	defer cache.Close()
+
+	if cache.done != nil {
+		t.Fatal("cleaner must not run until started")
+	}
+
+	cache.Set("one", 1)
+	cache.Set("two", 2)
+	mu.Lock()
+	now = now.Add(ttl)
+	mu.Unlock()
+
+	time.Sleep(2 * ttl)
+	if got := cache.ExpiredCount(); got != 2 {
+		t.Errorf("expired elements must wait for the cleaner: got = %v, want = %v", got, 2)
+	}
+
+	if cache.Contains("one") {
+		t.Error("expired element must be deleted lazily on access")
+	}
+
+	if err := cache.StartCleaner(); err != nil {
+		t.Fatalf("not expected error = %v", err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for cache.Len() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expired element wasn't swept by the started cleaner")
+		}
+		time.Sleep(ttl / ticks)
+	}
+}
+
+func TestClose(t *testing.T) {
+	cases := []struct {
+		name         string
+		clearOnClose bool
+		close        bool
+		clear        bool
+		purge        bool
+		running      bool
+		data         bool
+	}{
+		{
+			name:    "purge",
+			purge:   true,
+			running: true,
+		},
+		{
+			name:  "clear",
+			clear: true,
+		},
+		{
+			name:  "purge and close",
+			purge: true,
+			close: true,
+		},
+		{
+			name:  "close",
+			close: true,
+			data:  true,
+		},
+		{
+			name:         "close with clear on close",
+			clearOnClose: true,
+			close:        true,
+		},
+		{
+			name:  "close and clear",
+			close: true,
+			clear: true,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			const (
+				cap   = 2
+				ttl   = 20 * time.Second
+				ticks = 2
+			)
+
+			cache, _ := New(cap, WithTTL(ttl, ticks), WithClearOnClose(tt.clearOnClose))
+			defer cache.cancel()
+
+			cache.Set("one", 1)
+
+			if tt.close {
+				cache.Close()
+				cache.Close()
+			}
+			if tt.purge {
+				cache.Purge()
+				cache.Purge()
+			}
+			if tt.clear {
+				cache.Clear()
+				cache.Clear()
+			}
+
+			select {
+			case <-cache.done:
+				if tt.running {
+					t.Error("cleaner must keep running")
+				}
+			default:
+				if !tt.running {
+					t.Error("cleaner must be stopped")
+				}
+			}
+
+			if got := cache.Contains("one"); got != tt.data {
+				t.Errorf("invalid data presence: got = %v, want = %v", got, tt.data)
+			}
+		})
+	}
+
+	t.Run("set after close", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap   = 3
+			ttl   = time.Minute
+			ticks = 2
+		)
+
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		cache, _ := New(cap, WithTTL(ttl, ticks), WithNowFunc(func() time.Time { return now }))
+
+		cache.Set("one", 1)
+		cache.Close()
+		cache.Set("two", 2)
+
+		if got, ok := cache.Get("two"); !ok || got != 2 {
+			t.Errorf("element set after close must be readable: got = %v, want = %v", got, 2)
+		}
+
+		now = now.Add(ttl)
+		cache.Set("three", 3)
+
+		if _, ok := cache.Get("two"); ok {
+			t.Error("element set after close must expire lazily")
+		}
+
+		cache.DeleteExpired()
+		if got, want := cache.Len(), 1; got != want {
+			t.Errorf("invalid length: got = %v, want = %v", got, want)
+		}
+
+		cache.Close()
+	})
+
+	t.Run("without ttl", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 2
+		cache, _ := New(cap)
+		cache.Set("one", 1)
+		cache.Close()
+
+		if !cache.Contains("one") {
+			t.Error("data must be kept")
+		}
+	})
+}
+
+func TestExpiry(t *testing.T) {
+	t.Run("with ttl", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap   = 2
+			ttl   = time.Minute
+			ticks = 2
+		)
+
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		cache, _ := New(cap, WithTTL(ttl, ticks), WithNowFunc(func() time.Time { return now }))
+		cache.cancel()
+
+		cache.Set("one", 1)
+		cache.Set("two", 2)
+		now = now.Add(time.Second)
+
+		got, exist := cache.Expiry("one")
+		if !exist {
+			t.Error("true expected")
+		}
+
+		if want := now.Add(ttl - time.Second); !got.Equal(want) {
+			t.Errorf("invalid expiry: got = %v, want = %v", got, want)
+		}
+
+		if got := cache.queue.Back().Value.(*listItem).key; got != "one" {
+			t.Errorf("element must not be promoted: back = %v", got)
+		}
+	})
+
+	t.Run("without ttl", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 2
+		cache, _ := New(cap)
+		cache.Set("one", 1)
+
+		if got, exist := cache.Expiry("one"); !exist || !got.IsZero() {
+			t.Errorf("zero expiry expected: got = %v, %v", got, exist)
+		}
+
+		if _, exist := cache.Expiry("absent"); exist {
+			t.Error("false expected for missing key")
+		}
+	})
+}
+
+func TestIsFull(t *testing.T) {
+	t.Parallel()
+
+	const cap = 3
+	cache, _ := New(cap)
+
+	for i := range cap {
+		if cache.IsFull() {
+			t.Errorf("cache isn't full with %v elements", i)
+		}
+		cache.Set(Key(strconv.Itoa(i)), i)
+	}
+
+	if !cache.IsFull() {
+		t.Error("cache must be full")
+	}
+
+	cache.Delete("0")
+
+	if cache.IsFull() {
+		t.Error("cache isn't full after delete")
+	}
+}
+
+func TestSetMultiWithTTL(t *testing.T) {
+	t.Parallel()
+
+	const (
+		cap      = 4
+		ttl      = time.Minute
+		batchTTL = time.Hour
+		ticks    = 2
+	)
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache, _ := New(cap, WithTTL(ttl, ticks), WithNowFunc(func() time.Time { return now }))
+	cache.cancel()
+
+	cache.Set("one", 0)
+	cache.SetMultiWithTTL(map[Key]any{"one": 1, "two": 2, "three": 3}, batchTTL)
+
+	for _, key := range []Key{"one", "two", "three"} {
+		if got, want := cache.items[key].Value.(*listItem).expiresAt, now.Add(batchTTL); !got.Equal(want) {
+			t.Errorf("key %v must get batch expiry: got = %v, want = %v", key, got, want)
+		}
+	}
+
+	now = now.Add(time.Second)
+	cache.Get("two")
+	if got, want := cache.items["two"].Value.(*listItem).expiresAt, now.Add(batchTTL); !got.Equal(want) {
+		t.Errorf("access must refresh by batch ttl: got = %v, want = %v", got, want)
+	}
+
+	cache.Set("four", 4)
+	if got, want := cache.items["four"].Value.(*listItem).expiresAt, now.Add(ttl); !got.Equal(want) {
+		t.Errorf("default ttl must be unaffected: got = %v, want = %v", got, want)
+	}
+}
+
+func TestWithPanicHandler(t *testing.T) {
+	t.Parallel()
+
+	const cap = 1
+
+	var recovered []any
+	cache, _ := New(cap,
+		WithOnEvict(func(key Key, _ any, _ EvictReason) { panic(key) }),
+		WithPanicHandler(func(r any) { recovered = append(recovered, r) }),
+	)
+
+	cache.Set("one", 1)
+	cache.Set("two", 2)
+	cache.Set("three", 3)
+
+	if want := []any{Key("one"), Key("two")}; !reflect.DeepEqual(recovered, want) {
+		t.Errorf("invalid recovered panics: got = %v, want = %v", recovered, want)
+	}
+
+	if !cache.mu.TryLock() {
+		t.Fatal("lock wasn't released")
+	}
+	cache.mu.Unlock()
+
+	if value, exist := cache.Get("three"); !exist || value != 3 {
+		t.Errorf("cache must remain usable: got = %v, %v", value, exist)
+	}
+}
+
+func TestWithValueEquals(t *testing.T) {
+	cases := []struct {
+		name      string
+		value     any
+		refreshed bool
+	}{
+		{"same value", 1, false},
+		{"changed value", 2, true},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			const (
+				cap = 2
+				ttl = time.Minute
+			)
+			now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+			cache, _ := New(cap, WithNowFunc(func() time.Time { return now }), WithValueEquals(func(a, b any) bool { return a == b }))
+			cache.SetDefaultTTL(ttl)
+
+			cache.Set("one", 1)
+			cache.Set("two", 2)
+			before, _ := cache.Expiry("one")
+
+			now = now.Add(time.Second)
+			if !cache.Set("one", tt.value) {
+				t.Error("true expected for existing element")
+			}
+			after, _ := cache.Expiry("one")
+
+			if got := after.After(before); got != tt.refreshed {
+				t.Errorf("invalid expiry refresh: before = %v, after = %v", before, after)
+			}
+
+			if got, _ := cache.SinceUpdate("one"); (got == 0) != tt.refreshed {
+				t.Errorf("invalid update time: got = %v since update", got)
+			}
+
+			if got := cache.OrderedEntries()[0].Key; got != "one" {
+				t.Errorf("element must be promoted: front = %v", got)
+			}
+		})
+	}
+
+	t.Run("nil function", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 2
+		if _, err := New(cap, WithValueEquals(nil)); err == nil {
+			t.Error("error expected")
+		}
+	})
+}
+
+func TestWithNoRefreshOnUpdate(t *testing.T) {
+	cases := []struct {
+		name      string
+		options   []Option
+		refreshed bool
+	}{
+		{
+			"default",
+			nil,
+			true,
+		},
+		{
+			"no refresh on update",
+			[]Option{WithNoRefreshOnUpdate()},
+			false,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			const (
+				cap   = 2
+				ttl   = time.Minute
+				ticks = 2
+			)
+
+			now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+			options := append([]Option{WithTTL(ttl, ticks), WithNowFunc(func() time.Time { return now })}, tt.options...)
+			cache, _ := New(cap, options...)
+			cache.cancel()
+
+			cache.Set("one", 1)
+			cache.Set("two", 2)
+			before, _ := cache.Expiry("one")
+
+			now = now.Add(time.Second)
+			cache.Set("one", "ONE")
+			after, _ := cache.Expiry("one")
+
+			if got := after.After(before); got != tt.refreshed {
+				t.Errorf("invalid expiry refresh: before = %v, after = %v", before, after)
+			}
+
+			if value, _ := cache.Peek("one"); value != "ONE" {
+				t.Errorf("value wasn't updated: got = %v", value)
+			}
+
+			if got := cache.queue.Front().Value.(*listItem).key; got != "one" {
+				t.Errorf("element wasn't promoted: front = %v", got)
+			}
+
+			cache.SetWithExpiry("two", 2, now.Add(time.Hour))
+			cache.SetMultiWithTTL(map[Key]any{"two": "TWO"}, time.Second)
+			if got, _ := cache.Expiry("two"); !got.Equal(now.Add(time.Second)) {
+				t.Errorf("batch ttl wasn't set: got = %v, want = %v", got, now.Add(time.Second))
+			}
+		})
+	}
+}
+
+func TestRemoveFunc(t *testing.T) {
+	cases := []struct {
+		name    string
+		pred    func(key Key, value any) bool
+		removed int
+		kept    []Key
+	}{
+		{
+			"by key prefix",
+			func(key Key, _ any) bool { return strings.HasPrefix(string(key), "user:") },
+			2,
+			[]Key{"session:1"},
+		},
+		{
+			"by value",
+			func(_ Key, value any) bool { return value.(int) > 1 },
+			2,
+			[]Key{"user:1"},
+		},
+		{
+			"none",
+			func(Key, any) bool { return false },
+			0,
+			[]Key{"session:1", "user:2", "user:1"},
+		},
+		{
+			"all",
+			func(Key, any) bool { return true },
+			3,
+			nil,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			const cap = 3
+			cache, _ := New(cap)
+			cache.Set("user:1", 1)
+			cache.Set("user:2", 2)
+			cache.Set("session:1", 3)
+
+			if got := cache.RemoveFunc(tt.pred); got != tt.removed {
+				t.Errorf("invalid removed count: got = %v, want = %v", got, tt.removed)
+			}
+
+			var got []Key
+			for node := cache.queue.Front(); node != nil; node = node.Next() {
+				got = append(got, node.Value.(*listItem).key)
+			}
+
+			if !reflect.DeepEqual(got, tt.kept) {
+				t.Errorf("invalid kept keys: got = %v, want = %v", got, tt.kept)
+			}
+
+			if len(cache.items) != len(tt.kept) {
+				t.Errorf("cache.items is out of sync: %v", cache.items)
+			}
+		})
+	}
+}
+
+func TestSetWithResult(t *testing.T) {
+	cases := []struct {
+		name string
+		key  Key
+		want SetResult
+	}{
+		{"update", "one", SetResult{Updated: true}},
+		{"insert", "three", SetResult{Inserted: true}},
+		{"insert with eviction", "four", SetResult{Inserted: true, Evicted: true, EvictedKey: "two", EvictedCount: 1}},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			const cap = 3
+			cache, _ := New(cap)
+			cache.Set("two", 2)
+			cache.Set("one", 1)
+			if tt.want.Evicted {
+				cache.Set("three", 3)
+			}
+
+			if got := cache.SetWithResult(tt.key, 0); got != tt.want {
+				t.Errorf("got = %+v, want = %+v", got, tt.want)
+			}
+
+			if !cache.Contains(tt.key) {
+				t.Error("element must be stored")
+			}
+
+			if tt.want.Evicted && cache.Contains(tt.want.EvictedKey) {
+				t.Error("evicted element must be removed")
+			}
+		})
+	}
+}
+
+func TestSetWithResultLowWatermark(t *testing.T) {
+	t.Parallel()
+
+	const (
+		cap       = 10
+		watermark = 0.5
+		kept      = 5 // cap * watermark
+	)
+	cache, _ := New(cap, WithEvictionLowWatermark(watermark))
+	for i := range cap {
+		cache.Set(IntKey(i), i)
+	}
+
+	want := SetResult{Inserted: true, Evicted: true, EvictedKey: IntKey(0), EvictedCount: cap - kept}
+	if got := cache.SetWithResult("new", 0); got != want {
+		t.Errorf("got = %+v, want = %+v", got, want)
+	}
+
+	if got, want := cache.Len(), kept+1; got != want {
+		t.Errorf("SetWithResult must evict like Set: got length = %v, want = %v", got, want)
+	}
+}
+
+func TestIncrement(t *testing.T) {
+	cases := []struct {
+		name    string
+		initial any
+		want    int64
+		ok      bool
+		stored  any
+	}{
+		{"absent", nil, 5, true, int64(5)},
+		{"existing int64", int64(10), 15, true, int64(15)},
+		{"existing int", 10, 15, true, 15},
+		{"type mismatch", "ten", 0, false, "ten"},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			const (
+				cap   = 2
+				delta = 5
+			)
+			now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+			cache, _ := New(cap, WithNowFunc(func() time.Time { return now }))
+			cache.SetDefaultTTL(time.Minute)
+			if tt.initial != nil {
+				cache.Set("counter", tt.initial)
+			}
+
+			got, ok := cache.Increment("counter", delta)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("got = %v %v, want = %v %v", got, ok, tt.want, tt.ok)
+			}
+
+			if value, _ := cache.Peek("counter"); value != tt.stored {
+				t.Errorf("invalid stored value: got = %#v, want = %#v", value, tt.stored)
+			}
+
+			if at, _ := cache.Expiry("counter"); !at.Equal(now.Add(time.Minute)) {
+				t.Errorf("ttl must apply: got = %v", at)
+			}
+		})
+	}
+
+	t.Run("concurrent increments", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap        = 2
+			goroutines = 8
+			ops        = 100
+		)
+		cache, _ := New(cap)
+
+		var wg sync.WaitGroup
+		for range goroutines {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for range ops {
+					cache.Increment("counter", 1)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if got, _ := cache.Peek("counter"); got != int64(goroutines*ops) {
+			t.Errorf("increments lost: got = %v, want = %v", got, goroutines*ops)
+		}
+	})
+}
+
+func TestWithMaxKeyLen(t *testing.T) {
+	const maxKeyLen = 4
+
+	cases := []struct {
+		name  string
+		key   Key
+		added bool
+	}{
+		{"below limit", "abc", true},
+		{"at limit", "abcd", true},
+		{"above limit", "abcde", false},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			const cap = 2
+			cache, _ := New(cap, WithMaxKeyLen(maxKeyLen))
+
+			if updated := cache.Set(tt.key, 1); updated {
+				t.Error("false expected")
+			}
+			cache.SetWithExpiry(tt.key, 1, time.Time{})
+			cache.SetMultiWithTTL(map[Key]any{tt.key: 1}, time.Minute)
+
+			if got := cache.Contains(tt.key); got != tt.added {
+				t.Errorf("invalid key presence: got = %v, want = %v", got, tt.added)
+			}
+
+			if got := cache.SetWithCost(tt.key, 1, 1); got != tt.added {
+				t.Errorf("invalid SetWithCost result: got = %v, want = %v", got, tt.added)
+			}
+		})
+	}
+
+	t.Run("invalid max key length", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 2
+		if _, err := New(cap, WithMaxKeyLen(0)); err == nil {
+			t.Error("error expected")
+		}
+	})
+
+	t.Run("rejected key doesn't evict", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 1
+		cache, _ := New(cap, WithMaxKeyLen(maxKeyLen))
+		cache.Set("one", 1)
+		cache.Set("too long", 2)
+
+		if !cache.Contains("one") || cache.Len() != 1 {
+			t.Error("rejected key must not change cache")
+		}
+	})
+}
+
+func TestWithRefreshThrottle(t *testing.T) {
+	t.Run("reads", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap      = 2
+			ttl      = time.Minute
+			ticks    = 2
+			throttle = 10 * time.Second
+			step     = time.Second
+			reads    = 100
+		)
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		cache, _ := New(cap, WithNowFunc(func() time.Time { return now }), WithTTLPaused(ttl, ticks), WithRefreshThrottle(throttle))
+		cache.Set("one", 1)
+
+		updates := 0
+		last, _ := cache.Expiry("one")
+		for range reads {
+			now = now.Add(step)
+			cache.Get("one")
+			cache.GetQuiet("one")
+			if expiresAt, _ := cache.Expiry("one"); !expiresAt.Equal(last) {
+				if expiresAt.Sub(last) < throttle {
+					t.Errorf("expiration must move at most once per throttle window: got step = %v", expiresAt.Sub(last))
+				}
+				last = expiresAt
+				updates++
+			}
+		}
+
+		if want := int(reads * step / throttle); updates != want {
+			t.Errorf("got updates = %v, want = %v", updates, want)
+		}
+	})
+
+	t.Run("refresh isn't throttled", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap      = 2
+			ttl      = time.Minute
+			ticks    = 2
+			throttle = 10 * time.Second
+		)
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		cache, _ := New(cap, WithNowFunc(func() time.Time { return now }), WithTTLPaused(ttl, ticks), WithRefreshThrottle(throttle))
+		cache.Set("one", 1)
+		now = now.Add(time.Second)
+
+		cache.Refresh("one")
+		if got, _ := cache.Expiry("one"); !got.Equal(now.Add(ttl)) {
+			t.Errorf("got = %v, want = %v", got, now.Add(ttl))
+		}
+	})
+
+	t.Run("invalid throttle", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 2
+		if _, err := New(cap, WithRefreshThrottle(0)); err == nil {
+			t.Error("got = <nil>, want error")
+		}
+	})
+}
+
+func TestWithRejectNilValues(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 2
+		cache, _ := New(cap)
+		cache.Set("one", nil)
+
+		if value, exist := cache.Get("one"); !exist || value != nil {
+			t.Errorf("nil must be stored: got = %v, %v, want = <nil>, true", value, exist)
+		}
+	})
+
+	t.Run("option", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 2
+		cache, _ := New(cap, WithRejectNilValues())
+		if cache.Set("one", nil) || cache.Contains("one") {
+			t.Error("nil value must not be stored")
+		}
+
+		cache.Set("one", 1)
+		if updated := cache.Set("one", nil); updated {
+			t.Errorf("got = %v, want = %v", updated, false)
+		}
+		if _, exist := cache.Get("one"); exist {
+			t.Error("nil value must delete the element")
+		}
+
+		cache.Set("two", 2)
+		if got := cache.SetWithResult("two", nil); got != (SetResult{}) {
+			t.Errorf("got = %+v, want = %+v", got, SetResult{})
+		}
+		if cache.Contains("two") {
+			t.Error("nil value must delete the element")
+		}
+	})
+
+	t.Run("other methods", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 10
+		src := &fakeSource{values: map[Key]any{}}
+		cache, _ := New(cap, WithRejectNilValues(), WithSource(src))
+		for _, key := range []Key{"update", "swap", "meta", "expiry", "multi", "warm"} {
+			cache.Set(key, 1)
+		}
+
+		if cache.Update("update", nil) {
+			t.Error("Update must not store nil")
+		}
+		if value, replaced := cache.Swap("swap", nil); replaced || value != nil {
+			t.Errorf("got = %v, %v, want = <nil>, false", value, replaced)
+		}
+		cache.SetWithMeta("meta", nil, 0)
+		cache.SetWithExpiry("expiry", nil, time.Time{})
+		cache.SetMultiWithTTL(map[Key]any{"multi": nil}, time.Minute)
+		cache.Warm([]Entry{{Key: "warm", Value: nil}})
+
+		if got := cache.Len(); got != 0 {
+			t.Errorf("nil values must delete elements: got = %v", cache.Snapshot())
+		}
+
+		if value, exist := cache.Get("loaded"); exist || value != nil {
+			t.Errorf("loaded nil must be a miss: got = %v, %v", value, exist)
+		}
+		if cache.Contains("loaded") {
+			t.Error("loaded nil must not be stored")
+		}
+	})
+}
+
+func TestWithRejectEmptyKeys(t *testing.T) {
+	cases := []struct {
+		name    string
+		options []Option
+		stored  bool
+	}{
+		{"without option", nil, true},
+		{"with option", []Option{WithRejectEmptyKeys()}, false},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			const cap = 2
+			src := &fakeSource{values: map[Key]any{"": "loaded"}}
+			cache, _ := New(cap, append(tt.options, WithSource(src))...)
+
+			cache.Set("", 1)
+			if got := cache.Contains(""); got != tt.stored {
+				t.Errorf("invalid empty key presence: got = %v, want = %v", got, tt.stored)
+			}
+
+			if _, ok := cache.Get(""); ok != tt.stored {
+				t.Errorf("invalid Get result: got = %v, want = %v", ok, tt.stored)
+			}
+
+			if got := atomic.LoadInt64(&src.loads); got != 0 {
+				t.Errorf("empty key must not be loaded: got loads = %v", got)
+			}
+
+			cache.Set("one", 1)
+			if !cache.Contains("one") {
+				t.Error("non-empty key must be stored")
+			}
+		})
+	}
+}
+
+func TestDeleteMulti(t *testing.T) {
+	cases := []struct {
+		name    string
+		keys    []Key
+		deleted int
+		kept    []Key
+	}{
+		{"present and absent", []Key{"one", "absent", "three"}, 2, []Key{"two"}},
+		{"duplicates", []Key{"two", "two"}, 1, []Key{"three", "one"}},
+		{"absent only", []Key{"absent"}, 0, []Key{"three", "two", "one"}},
+		{"empty", nil, 0, []Key{"three", "two", "one"}},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			const cap = 3
+			cache, _ := New(cap)
+			cache.Set("one", 1)
+			cache.Set("two", 2)
+			cache.Set("three", 3)
+
+			if got := cache.DeleteMulti(tt.keys); got != tt.deleted {
+				t.Errorf("invalid deleted count: got = %v, want = %v", got, tt.deleted)
+			}
+
+			var kept []Key
+			for _, e := range cache.Snapshot() {
+				kept = append(kept, e.Key)
+			}
+			if !reflect.DeepEqual(kept, tt.kept) {
+				t.Errorf("invalid kept keys: got = %v, want = %v", kept, tt.kept)
+			}
+
+			if err := cache.Validate(); err != nil {
+				t.Errorf("not expected error = %v", err)
+			}
+		})
+	}
+}
+
+func TestKeysWithPrefix(t *testing.T) {
+	cases := []struct {
+		name   string
+		prefix Key
+		want   []Key
+	}{
+		{"matching", "user:", []Key{"user:2", "user:1"}},
+		{"single match", "session:", []Key{"session:1"}},
+		{"non-matching", "order:", nil},
+		{"empty prefix", "", []Key{"session:1", "user:2", "user:1"}},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			const cap = 3
+			cache, _ := New(cap)
+			cache.Set("user:1", 1)
+			cache.Set("user:2", 2)
+			cache.Set("session:1", 3)
+
+			if got := cache.KeysWithPrefix(tt.prefix); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got = %v, want = %v", got, tt.want)
+			}
+
+			if cache.Len() != cap {
+				t.Error("elements must be kept")
+			}
+		})
+	}
+
+	t.Run("expired", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 3
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		cache, _ := New(cap, WithNowFunc(func() time.Time { return now }))
+		cache.SetWithExpiry("user:1", 1, now.Add(time.Second))
+		cache.Set("user:2", 2)
+		now = now.Add(time.Second)
+
+		want := []Key{"user:2"}
+		if got := cache.KeysWithPrefix("user:"); !reflect.DeepEqual(got, want) {
+			t.Errorf("got = %v, want = %v", got, want)
+		}
+	})
+}
+
+func TestGetOrDefault(t *testing.T) {
+	t.Parallel()
+
+	const cap = 2
+	cache, _ := New(cap)
+	cache.Set("one", 1)
+	cache.Set("zero", 0)
+
+	cases := []struct {
+		key  Key
+		want any
+	}{
+		{"one", 1},
+		{"absent", -1},
+		{"zero", 0},
+	}
+
+	for _, tt := range cases {
+		if got := cache.GetOrDefault(tt.key, -1); got != tt.want {
+			t.Errorf("invalid value for key %v: got = %v, want = %v", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestWithMemoryPressureHook(t *testing.T) {
+	t.Parallel()
+
+	const (
+		cap      = 100
+		shrinkBy = 0.5
+		floor    = 20
+	)
+
+	signals := make(chan struct{})
+	cache, _ := New(cap, WithMemoryPressureHook(signals, shrinkBy), WithMemoryPressureFloor(floor))
+	defer cache.Close()
+
+	for i := range cap {
+		cache.Set(Key(strconv.Itoa(i)), i)
+	}
+
+	for _, want := range []int{50, 25, floor, floor} {
+		signals <- struct{}{}
+
+		deadline := time.Now().Add(time.Second)
+		for cache.Len() != want && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+
+		if got := cache.Len(); got != want {
+			t.Errorf("invalid size after signal: got = %v, want = %v", got, want)
+		}
+	}
+
+	if _, exist := cache.Peek(Key(strconv.Itoa(cap - 1))); !exist {
+		t.Error("most recently used element must survive")
+	}
+}
+
+func TestWithMemoryPressureHookFailedNew(t *testing.T) {
+	t.Parallel()
+
+	const (
+		cap      = 2
+		shrinkBy = 0.5
+		wait     = 50 * time.Millisecond
+	)
+
+	signals := make(chan struct{})
+	if _, err := New(cap, WithMemoryPressureHook(signals, shrinkBy), WithMaxKeyLen(0)); err == nil {
+		t.Fatal("error expected")
+	}
+
+	select {
+	case signals <- struct{}{}:
+		t.Error("hook must not be started when New fails")
+	case <-time.After(wait):
+	}
+}
+
+func TestWithTTLStartedByNew(t *testing.T) {
+	const (
+		cap        = 2
+		ttl        = time.Minute
+		ticks      = 2
+		resolution = time.Millisecond
+	)
+
+	t.Run("option doesn't start cleaner", func(t *testing.T) {
+		t.Parallel()
+
+		lruCache := &LRUCache{}
+		if err := WithTTL(ttl, ticks)(lruCache); err != nil {
+			t.Fatalf("not expected error = %v", err)
+		}
+		if lruCache.cancel != nil {
+			lruCache.cancel()
+			t.Error("cleaner must be started by New, not by the option")
+		}
+	})
+
+	t.Run("later options", func(t *testing.T) {
+		t.Parallel()
+
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		cache, err := New(cap, WithTTLResolution(resolution), WithTTL(ttl, ticks),
+			WithLockProfiling(), WithNowFunc(func() time.Time { return now }))
+		if err != nil {
+			t.Fatalf("not expected error = %v", err)
+		}
+		defer cache.Close()
+
+		if cache.cancel == nil {
+			t.Error("cleaner must be running")
+		}
+	})
+}
+
+func TestSwap(t *testing.T) {
+	t.Parallel()
+
+	const cap = 2
+	cache, _ := New(cap)
+	cache.Set("one", 1)
+	cache.Set("two", 2)
+
+	old, had := cache.Swap("one", "ONE")
+	if !had || old != 1 {
+		t.Errorf("old value expected: got = %v, %v", old, had)
+	}
+
+	if value, _ := cache.Peek("one"); value != "ONE" {
+		t.Errorf("value wasn't swapped: got = %v", value)
+	}
+
+	if got := cache.queue.Front().Value.(*listItem).key; got != "one" {
+		t.Errorf("element wasn't promoted: front = %v", got)
+	}
+
+	old, had = cache.Swap("three", 3)
+	if had || old != nil {
+		t.Errorf("absent key expected: got = %v, %v", old, had)
+	}
+
+	if value, _ := cache.Peek("three"); value != 3 {
+		t.Errorf("value wasn't inserted: got = %v", value)
+	}
+
+	if cache.Contains("two") {
+		t.Error("least recently used element must be evicted")
+	}
+}
+
+func TestGetQuiet(t *testing.T) {
+	t.Parallel()
+
+	const (
+		cap   = 2
+		ttl   = time.Minute
+		ticks = 2
+	)
+
+	clock := NewTestClock()
+	cache, _ := New(cap, WithTTL(ttl, ticks), WithClock(clock))
+	cache.cancel()
+
+	cache.Set("one", 1)
+	cache.Set("two", 2)
+	clock.Advance(time.Second)
+
+	value, exist := cache.GetQuiet("one")
+	if !exist || value != 1 {
+		t.Errorf("value expected: got = %v, %v", value, exist)
+	}
+
+	if got, _ := cache.Expiry("one"); !got.Equal(clock.Now().Add(ttl)) {
+		t.Errorf("ttl wasn't refreshed: got = %v, want = %v", got, clock.Now().Add(ttl))
+	}
+
+	if got := cache.queue.Back().Value.(*listItem).key; got != "one" {
+		t.Errorf("recency order must be unchanged: back = %v", got)
+	}
+}
+
+func TestResize(t *testing.T) {
+	t.Parallel()
+
+	const cap = 4
+	cache, _ := New(cap)
+
+	for i := range cap {
+		cache.Set(Key(strconv.Itoa(i)), i)
+	}
+
+	if err := cache.Resize(2); err != nil {
+		t.Errorf("not expected error = %v", err)
+	}
+
+	if got := cache.Len(); got != 2 {
+		t.Errorf("cache must shrink: got = %v, want = %v", got, 2)
+	}
+
+	for _, key := range []Key{"2", "3"} {
+		if !cache.Contains(key) {
+			t.Errorf("most recently used key %v must be kept", key)
+		}
+	}
+
+	if err := cache.Resize(8); err != nil {
+		t.Errorf("not expected error = %v", err)
+	}
+
+	for i := range 8 {
+		cache.Set(Key(strconv.Itoa(i)), i)
+	}
+
+	if got := cache.Len(); got != 8 {
+		t.Errorf("cache must grow: got = %v, want = %v", got, 8)
+	}
+
+	if err := cache.Resize(0); err == nil {
+		t.Error("error expected")
+	}
+}
+
+func TestWithAutoTune(t *testing.T) {
+	t.Parallel()
+
+	const (
+		cap         = 10
+		maxCap      = 80
+		window      = 20
+		minHitRatio = 0.5
+		keys        = 100
+	)
+
+	cache, _ := New(cap, WithAutoTune(minHitRatio, maxCap, window))
+
+	// cycling over more keys than capacity always misses
+	for i := range 10 * keys {
+		key := Key(strconv.Itoa(i % keys))
+		if _, exist := cache.Get(key); !exist {
+			cache.Set(key, i)
+		}
+	}
+
+	if got := cache.cap; got != maxCap {
+		t.Errorf("capacity must grow to max: got = %v, want = %v", got, maxCap)
+	}
+
+	stats := cache.Stats()
+	if stats.Hits+stats.Misses != 10*keys {
+		t.Errorf("invalid number of reads: got = %v", stats)
+	}
+}
+
+func TestMeta(t *testing.T) {
+	t.Parallel()
+
+	const cap = 2
+	cache, _ := New(cap)
+
+	if cache.SetWithMeta("one", 1, "v1") {
+		t.Error("added new value: false expected")
+	}
+
+	cache.Get("one")
+	cache.Set("one", "ONE")
+
+	if meta, exist := cache.GetMeta("one"); !exist || meta != "v1" {
+		t.Errorf("metadata must persist: got = %v, %v", meta, exist)
+	}
+
+	if !cache.SetWithMeta("one", 1, "v2") {
+		t.Error("updated existing value: true expected")
+	}
+
+	if meta, _ := cache.GetMeta("one"); meta != "v2" {
+		t.Errorf("metadata wasn't updated: got = %v", meta)
+	}
+
+	cache.Set("two", 2)
+	cache.Set("three", 3)
+	cache.Set("one", 1)
+
+	if meta, exist := cache.GetMeta("one"); !exist || meta != nil {
+		t.Errorf("metadata must be cleared on eviction: got = %v, %v", meta, exist)
+	}
+
+	if _, exist := cache.GetMeta("absent"); exist {
+		t.Error("false expected")
+	}
+}
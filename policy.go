@@ -0,0 +1,253 @@
+package lrucache
+
+import (
+	"container/list"
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// Eviction policy implementation.
+// Nodes are always pushed to the front of the queue, policy decides how access reorders them
+// and which node is evicted.
+type evictionPolicy interface {
+	OnInsert(node *list.Element) // node was pushed to the front of the queue
+	OnAccess(node *list.Element) // node was read or updated
+	OnRemove(node *list.Element) // node is about to be removed from the queue
+	Victim() *list.Element       // node to evict
+
+	// node to evict instead of the victim node which must be kept, nil if there is no other node
+	After(node *list.Element) *list.Element
+}
+
+// Creates eviction policy implementation for the cache
+func newEvictionPolicy(l *LRUCache) evictionPolicy {
+	lru := lruPolicy{queue: l.queue}
+	switch l.policy {
+	case PolicyLFU:
+		return &lfuPolicy{lruPolicy: lru}
+	case Policy2Q:
+		return &twoQueuePolicy{lruPolicy: lru, cache: l}
+	case PolicyFIFO:
+		return &fifoPolicy{lruPolicy: lru}
+	case PolicyRandom:
+		if l.rnd == nil {
+			l.rnd = rand.New(rand.NewSource(time.Now().UnixNano()))
+		}
+		return &randomPolicy{lruPolicy: lru, rnd: l.rnd}
+	default:
+		return &lru
+	}
+}
+
+// Evicts the least recently used node
+type lruPolicy struct {
+	queue *list.List
+}
+
+func (p *lruPolicy) OnInsert(*list.Element) {}
+
+func (p *lruPolicy) OnAccess(node *list.Element) {
+	p.queue.MoveToFront(node)
+}
+
+func (p *lruPolicy) OnRemove(*list.Element) {}
+
+func (p *lruPolicy) Victim() *list.Element {
+	return p.queue.Back()
+}
+
+func (p *lruPolicy) After(node *list.Element) *list.Element {
+	return node.Prev()
+}
+
+// Evicts the least frequently used node, ties are broken by recency.
+// Nodes are grouped in buckets by access count for O(1) updates and eviction.
+type lfuPolicy struct {
+	lruPolicy
+	buckets list.List // frequency buckets in ascending frequency order
+}
+
+// Nodes with the same number of accesses
+type freqBucket struct {
+	freq  uint64
+	nodes list.List // the most recently used node first
+}
+
+func (p *lfuPolicy) OnInsert(node *list.Element) {
+	p.place(node, p.buckets.Front())
+}
+
+func (p *lfuPolicy) OnAccess(node *list.Element) {
+	p.lruPolicy.OnAccess(node)
+	p.place(node, p.unlink(node.Value.(*listItem)))
+}
+
+func (p *lfuPolicy) OnRemove(node *list.Element) {
+	p.unlink(node.Value.(*listItem))
+}
+
+func (p *lfuPolicy) Victim() *list.Element {
+	if p.buckets.Len() == 0 {
+		return nil
+	}
+	return p.buckets.Front().Value.(*freqBucket).nodes.Back().Value.(*list.Element)
+}
+
+func (p *lfuPolicy) After(node *list.Element) *list.Element {
+	item := node.Value.(*listItem)
+	if prev := item.bucketNode.Prev(); prev != nil {
+		return prev.Value.(*list.Element)
+	}
+	if next := item.bucket.Next(); next != nil {
+		return next.Value.(*freqBucket).nodes.Back().Value.(*list.Element)
+	}
+	return nil
+}
+
+// Adds node to the front of the bucket of its access count searching forward from bucket at,
+// buckets before at must have lower frequency
+func (p *lfuPolicy) place(node *list.Element, at *list.Element) {
+	item := node.Value.(*listItem)
+	freq := atomic.LoadUint64(&item.freq)
+	for at != nil && at.Value.(*freqBucket).freq < freq {
+		at = at.Next()
+	}
+
+	if at == nil || at.Value.(*freqBucket).freq != freq {
+		bucket := &freqBucket{freq: freq}
+		if at == nil {
+			at = p.buckets.PushBack(bucket)
+		} else {
+			at = p.buckets.InsertBefore(bucket, at)
+		}
+	}
+
+	item.bucket = at
+	item.bucketNode = at.Value.(*freqBucket).nodes.PushFront(node)
+}
+
+// Removes node from its bucket dropping the bucket if it becomes empty
+// Return: the bucket or the next one if the bucket was dropped
+func (p *lfuPolicy) unlink(item *listItem) *list.Element {
+	at := item.bucket
+	bucket := at.Value.(*freqBucket)
+	bucket.nodes.Remove(item.bucketNode)
+	item.bucket, item.bucketNode = nil, nil
+
+	if bucket.nodes.Len() > 0 {
+		return at
+	}
+	next := at.Next()
+	p.buckets.Remove(at)
+	return next
+}
+
+// Evicts nodes in insertion order
+type fifoPolicy struct {
+	lruPolicy
+}
+
+func (p *fifoPolicy) OnAccess(*list.Element) {}
+
+// Admits new nodes to the probationary queue, promotes them to the main queue on the second access.
+// Each queue keeps its nodes in recency order, so the victim is the back of one of them.
+type twoQueuePolicy struct {
+	lruPolicy
+	cache *LRUCache
+	a1    list.List // probationary nodes, the most recently inserted first
+	am    list.List // main queue nodes, the most recently used first
+}
+
+func (p *twoQueuePolicy) OnInsert(node *list.Element) {
+	item := node.Value.(*listItem)
+	item.probation = true
+	item.bucketNode = p.a1.PushFront(node)
+}
+
+func (p *twoQueuePolicy) OnAccess(node *list.Element) {
+	p.lruPolicy.OnAccess(node)
+	item := node.Value.(*listItem)
+	if !item.probation {
+		p.am.MoveToFront(item.bucketNode)
+		return
+	}
+
+	p.a1.Remove(item.bucketNode)
+	item.probation = false
+	item.bucketNode = p.am.PushFront(node)
+}
+
+func (p *twoQueuePolicy) OnRemove(node *list.Element) {
+	item := node.Value.(*listItem)
+	if item.probation {
+		p.a1.Remove(item.bucketNode)
+	} else {
+		p.am.Remove(item.bucketNode)
+	}
+	item.bucketNode = nil
+}
+
+func (p *twoQueuePolicy) Victim() *list.Element {
+	// probationary queue is limited by a quarter of the capacity,
+	// the main queue is drained only when the probationary one fits its limit
+	queue := &p.am
+	if p.a1.Len() > max(p.cache.cap/4, 1) || p.am.Len() == 0 {
+		queue = &p.a1
+	}
+	if back := queue.Back(); back != nil {
+		return back.Value.(*list.Element)
+	}
+	return nil
+}
+
+func (p *twoQueuePolicy) After(node *list.Element) *list.Element {
+	item := node.Value.(*listItem)
+	if prev := item.bucketNode.Prev(); prev != nil {
+		return prev.Value.(*list.Element)
+	}
+
+	other := &p.am
+	if !item.probation {
+		other = &p.a1
+	}
+	if back := other.Back(); back != nil {
+		return back.Value.(*list.Element)
+	}
+	return nil
+}
+
+// Evicts a random node. Nodes are kept in a slice for O(1) random choice.
+type randomPolicy struct {
+	lruPolicy
+	rnd   *rand.Rand
+	nodes []*list.Element
+}
+
+func (p *randomPolicy) OnInsert(node *list.Element) {
+	node.Value.(*listItem).slot = len(p.nodes)
+	p.nodes = append(p.nodes, node)
+}
+
+func (p *randomPolicy) OnRemove(node *list.Element) {
+	slot := node.Value.(*listItem).slot
+	last := p.nodes[len(p.nodes)-1]
+	last.Value.(*listItem).slot = slot
+	p.nodes[slot] = last
+	p.nodes[len(p.nodes)-1] = nil
+	p.nodes = p.nodes[:len(p.nodes)-1]
+}
+
+func (p *randomPolicy) Victim() *list.Element {
+	if len(p.nodes) == 0 {
+		return nil
+	}
+	return p.nodes[p.rnd.Intn(len(p.nodes))]
+}
+
+func (p *randomPolicy) After(node *list.Element) *list.Element {
+	if len(p.nodes) < 2 {
+		return nil
+	}
+	return p.nodes[(node.Value.(*listItem).slot+1)%len(p.nodes)]
+}
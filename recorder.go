@@ -0,0 +1,41 @@
+package lrucache
+
+import "sync"
+
+// Eviction callback recording evicted keys in order. Intended for tests:
+// pass its OnEvict to WithOnEvict instead of writing an ad-hoc closure.
+type EvictionRecorder struct {
+	mu      sync.Mutex
+	keys    []Key
+	reasons []EvictReason
+}
+
+// Creates empty eviction recorder
+func NewEvictionRecorder() *EvictionRecorder {
+	return &EvictionRecorder{}
+}
+
+// Records evicted element, matches EvictFunc
+func (r *EvictionRecorder) OnEvict(key Key, _ any, reason EvictReason) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.keys = append(r.keys, key)
+	r.reasons = append(r.reasons, reason)
+}
+
+// Returns a copy of evicted keys in eviction order
+func (r *EvictionRecorder) Keys() []Key {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Key(nil), r.keys...)
+}
+
+// Returns a copy of eviction reasons in eviction order
+func (r *EvictionRecorder) Reasons() []EvictReason {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]EvictReason(nil), r.reasons...)
+}
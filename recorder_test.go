@@ -0,0 +1,38 @@
+package lrucache
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEvictionRecorder(t *testing.T) {
+	t.Parallel()
+
+	const cap = 3
+	recorder := NewEvictionRecorder()
+	cache, _ := New(cap, WithOnEvict(recorder.OnEvict))
+
+	cache.Set("one", 1)
+	cache.Set("two", 2)
+	cache.Set("three", 3)
+	cache.Get("one")
+	cache.Set("four", 4)
+	cache.Set("five", 5)
+	cache.Get("one")
+	cache.Set("six", 6)
+	cache.ForceEvict(1)
+
+	want := []Key{"two", "three", "four", "five"}
+	if got := recorder.Keys(); !reflect.DeepEqual(got, want) {
+		t.Errorf("invalid eviction order: got = %v, want = %v", got, want)
+	}
+
+	wantReasons := []EvictReason{EvictCapacity, EvictCapacity, EvictCapacity, EvictManual}
+	if got := recorder.Reasons(); !reflect.DeepEqual(got, wantReasons) {
+		t.Errorf("invalid eviction reasons: got = %v, want = %v", got, wantReasons)
+	}
+
+	if got := NewEvictionRecorder().Keys(); len(got) != 0 {
+		t.Errorf("empty recorder expected: got = %v", got)
+	}
+}
@@ -0,0 +1,67 @@
+package lrucache
+
+import (
+	"errors"
+	"sync"
+)
+
+// Named caches sharing lifecycle and observability
+type Registry struct {
+	mu     sync.Mutex
+	caches map[string]*LRUCache
+	closed bool
+}
+
+var ErrRegistryClosed = errors.New("registry is closed")
+
+// Creates new empty Registry
+func NewRegistry() *Registry {
+	return &Registry{caches: make(map[string]*LRUCache)}
+}
+
+// Gets cache by name or creates it with New(cap, options...) if it doesn't exist.
+// cap and options are ignored for an existing cache.
+// Return: cache, New error or ErrRegistryClosed after Close
+func (r *Registry) GetOrCreate(name string, cap int, options ...Option) (*LRUCache, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return nil, ErrRegistryClosed
+	}
+
+	if cache, exist := r.caches[name]; exist {
+		return cache, nil
+	}
+
+	cache, err := New(cap, options...)
+	if err != nil {
+		return nil, err
+	}
+	r.caches[name] = cache
+	return cache, nil
+}
+
+// Returns statistics of every cache by name
+func (r *Registry) AggregateStats() map[string]Stats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats := make(map[string]Stats, len(r.caches))
+	for name, cache := range r.caches {
+		stats[name] = cache.Stats()
+	}
+	return stats
+}
+
+// Closes all caches (see LRUCache.Close), later GetOrCreate calls fail with ErrRegistryClosed.
+// The caches stay usable by their holders.
+func (r *Registry) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.closed = true
+	for _, cache := range r.caches {
+		cache.Close()
+	}
+}
@@ -0,0 +1,84 @@
+package lrucache
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRegistry(t *testing.T) {
+	t.Run("get or create", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 2
+		registry := NewRegistry()
+		defer registry.Close()
+
+		users, err := registry.GetOrCreate("users", cap)
+		if err != nil {
+			t.Fatalf("got = %v, want = <nil>", err)
+		}
+
+		if got, _ := registry.GetOrCreate("users", cap+1); got != users {
+			t.Error("existing cache must be returned")
+		}
+
+		if _, err := registry.GetOrCreate("invalid", 0); err == nil {
+			t.Error("New error expected")
+		}
+	})
+
+	t.Run("aggregate stats", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 4
+		registry := NewRegistry()
+		defer registry.Close()
+
+		users, _ := registry.GetOrCreate("users", cap)
+		orders, _ := registry.GetOrCreate("orders", cap)
+		users.Set("one", 1)
+		users.Get("one")
+		orders.Get("missing")
+
+		stats := registry.AggregateStats()
+		if got := len(stats); got != 2 {
+			t.Fatalf("got = %v, want = %v", got, 2)
+		}
+		if got := stats["users"]; got.Hits != 1 || got.Size != 1 {
+			t.Errorf("got users hits = %v, size = %v, want = 1, 1", got.Hits, got.Size)
+		}
+		if got := stats["orders"]; got.Misses != 1 || got.Size != 0 {
+			t.Errorf("got orders misses = %v, size = %v, want = 1, 0", got.Misses, got.Size)
+		}
+	})
+
+	t.Run("close all", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap   = 2
+			ttl   = time.Minute
+			ticks = 2
+		)
+		registry := NewRegistry()
+		names := []string{"users", "orders", "sessions"}
+		caches := make([]*LRUCache, len(names))
+		for i, name := range names {
+			caches[i], _ = registry.GetOrCreate(name, cap, WithTTL(ttl, ticks))
+		}
+
+		registry.Close()
+		for i, cache := range caches {
+			select {
+			case <-cache.done:
+			default:
+				t.Errorf("cleaner of %v must exit", names[i])
+			}
+		}
+
+		if _, err := registry.GetOrCreate("late", cap); !errors.Is(err, ErrRegistryClosed) {
+			t.Errorf("got = %v, want = %v", err, ErrRegistryClosed)
+		}
+	})
+}
@@ -0,0 +1,228 @@
+package lrucache
+
+import (
+	"errors"
+	"sync"
+)
+
+// Cache split into independently locked shards, keys are spread over shards by hash.
+// Capacity and eviction apply per shard.
+type ShardedCache struct {
+	mu      sync.RWMutex // guards shards, ReshardTo replaces them
+	shards  []*LRUCache
+	cap     int // total capacity
+	hasher  func(Key) uint64
+	options []Option
+}
+
+type ShardOption func(*ShardedCache) error
+
+// Fails the build if *ShardedCache diverges from Cache
+var _ Cache = (*ShardedCache)(nil)
+
+// Creates new ShardedCache, the total capacity is split evenly between shards
+func NewSharded(shards, cap int, options ...ShardOption) (*ShardedCache, error) {
+	if shards <= 0 {
+		return nil, errors.New("number of shards must be positive")
+	}
+
+	if cap < shards {
+		return nil, errors.New("cap must not be less than number of shards")
+	}
+
+	s := &ShardedCache{cap: cap, hasher: fnvHash}
+	for _, opt := range options {
+		if err := opt(s); err != nil {
+			return nil, err
+		}
+	}
+
+	var err error
+	s.shards, err = s.newShards(shards)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Creates n empty shards splitting the total capacity between them
+func (s *ShardedCache) newShards(n int) ([]*LRUCache, error) {
+	shards := make([]*LRUCache, n)
+	shardCap := (s.cap + n - 1) / n
+	for i := range shards {
+		shard, err := configure(append([]Option{WithCapacity(shardCap)}, s.options...))
+		if err != nil {
+			return nil, err
+		}
+
+		if shard.initial != nil || shard.pressure != nil || shard.randSrc != nil {
+			shard.Close()
+			return nil, errors.New("WithInitialEntries, WithMemoryPressureHook and WithRandSource can't be shard options")
+		}
+
+		shard.start()
+		shards[i] = shard
+	}
+	return shards, nil
+}
+
+// Changes number of shards keeping the data: new shards are created with the total capacity
+// split between them and live elements are moved to the shards their keys map to now.
+// Elements keep their expiration time, ttl, access counts and metadata, recency is kept within
+// every old shard. A new shard overflowing its capacity evicts elements as usual.
+// Other calls wait while resharding is in progress. Eviction callbacks run and old shards are closed
+// after that, so callbacks may call the cache.
+func (s *ShardedCache) ReshardTo(n int) error {
+	if n <= 0 {
+		return errors.New("number of shards must be positive")
+	}
+
+	if s.cap < n {
+		return errors.New("cap must not be less than number of shards")
+	}
+
+	shards, err := s.newShards(n)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	old := s.shards
+	s.shards = shards
+	pending := make(map[*LRUCache][]evicted)
+	for _, shard := range old {
+		for _, item := range shard.export() {
+			target := s.shard(item.key)
+			pending[target] = append(pending[target], target.adopt(item)...)
+		}
+	}
+	s.mu.Unlock()
+
+	for shard, evicted := range pending {
+		shard.flush(evicted)
+	}
+	for _, shard := range old {
+		shard.Close()
+	}
+	return nil
+}
+
+// Sets shard hash function option, FNV-1a is used by default.
+// The hash function must be deterministic, it selects the shard of the key.
+func WithShardHasher(fn func(Key) uint64) ShardOption {
+	return func(s *ShardedCache) error {
+		if fn == nil {
+			return errors.New("shard hasher must not be nil")
+		}
+
+		s.hasher = fn
+		return nil
+	}
+}
+
+// Sets options applied to every shard. Options acting on the whole cache are rejected by NewSharded:
+// WithInitialEntries would add every entry to all shards, WithMemoryPressureHook would make
+// shards compete for signals and WithRandSource would share one unsynchronized source between
+// independently locked shards. Add initial entries by Set instead.
+func WithShardCacheOptions(options ...Option) ShardOption {
+	return func(s *ShardedCache) error {
+		s.options = append(s.options, options...)
+		return nil
+	}
+}
+
+// Computes 64-bit FNV-1a hash of the key without allocations
+func fnvHash(key Key) uint64 {
+	const (
+		offset = 14695981039346656037
+		prime  = 1099511628211
+	)
+
+	hash := uint64(offset)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint64(key[i])
+		hash *= prime
+	}
+	return hash
+}
+
+// Finds shard of the key
+func (s *ShardedCache) shard(key Key) *LRUCache {
+	return s.shards[s.hasher(key)%uint64(len(s.shards))]
+}
+
+// Adds value to cache.
+// Return: true - existing element was updated, false - new element was added
+func (s *ShardedCache) Set(key Key, value any) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.shard(key).Set(key, value)
+}
+
+// Gets value from cache
+// Return: true - element exists, false - element doesn't exist
+func (s *ShardedCache) Get(key Key) (any, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.shard(key).Get(key)
+}
+
+// Gets value without changing its recency and ttl
+// Return: true - element exists, false - element doesn't exist
+func (s *ShardedCache) Peek(key Key) (any, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.shard(key).Peek(key)
+}
+
+// Checks if element exists without changing its recency and ttl
+func (s *ShardedCache) Contains(key Key) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.shard(key).Contains(key)
+}
+
+// Deletes element from cache
+// Return: true - element was deleted, false - element doesn't exist
+func (s *ShardedCache) Delete(key Key) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.shard(key).Delete(key)
+}
+
+// Returns number of elements in all shards
+func (s *ShardedCache) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	n := 0
+	for _, shard := range s.shards {
+		n += shard.Len()
+	}
+	return n
+}
+
+// Clears all shards, cancels ttl checks
+func (s *ShardedCache) Clear() {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, shard := range s.shards {
+		shard.Clear()
+	}
+}
+
+// Stops ttl checks of all shards, data is kept
+func (s *ShardedCache) Close() {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, shard := range s.shards {
+		shard.Close()
+	}
+}
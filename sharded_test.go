@@ -0,0 +1,249 @@
+package lrucache
+
+import (
+	"math/rand"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNewSharded(t *testing.T) {
+	cases := []struct {
+		name   string
+		shards int
+		cap    int
+		valid  bool
+	}{
+		{"valid", 4, 100, true},
+		{"zero shards", 0, 100, false},
+		{"cap less than shards", 4, 3, false},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cache, err := NewSharded(tt.shards, tt.cap)
+			if (err == nil) != tt.valid {
+				t.Fatalf("got = %v, want valid = %v", err, tt.valid)
+			}
+
+			if tt.valid && len(cache.shards) != tt.shards {
+				t.Errorf("invalid number of shards: got = %v, want = %v", len(cache.shards), tt.shards)
+			}
+		})
+	}
+
+	t.Run("shard options", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			shards = 2
+			cap    = 4
+		)
+		if _, err := NewSharded(shards, cap, WithShardCacheOptions(WithMaxKeyLen(0))); err == nil {
+			t.Error("shard option error expected")
+		}
+
+		if _, err := NewSharded(shards, cap, WithShardHasher(nil)); err == nil {
+			t.Error("error expected for nil hasher")
+		}
+
+		if _, err := NewSharded(shards, cap, WithShardCacheOptions(WithInitialEntries(map[Key]any{"one": 1}))); err == nil {
+			t.Error("error expected for initial entries")
+		}
+
+		if _, err := NewSharded(shards, cap, WithShardCacheOptions(WithMemoryPressureHook(make(chan struct{}), 0.5))); err == nil {
+			t.Error("error expected for memory pressure hook")
+		}
+
+		if _, err := NewSharded(shards, cap, WithShardCacheOptions(WithRandSource(rand.NewSource(1)))); err == nil {
+			t.Error("error expected for random source")
+		}
+	})
+}
+
+func TestShardedCache(t *testing.T) {
+	t.Parallel()
+
+	const (
+		shards = 4
+		cap    = 100
+		count  = 50
+	)
+	cache, _ := NewSharded(shards, cap)
+
+	for i := range count {
+		cache.Set(IntKey(i), i)
+	}
+
+	if got := cache.Len(); got != count {
+		t.Errorf("invalid length: got = %v, want = %v", got, count)
+	}
+
+	for i := range count {
+		if got, ok := cache.Get(IntKey(i)); !ok || got != i {
+			t.Errorf("got = %v, want = %v", got, i)
+		}
+	}
+
+	if !cache.Delete(IntKey(0)) || cache.Contains(IntKey(0)) {
+		t.Error("element must be deleted")
+	}
+
+	cache.Clear()
+	if got := cache.Len(); got != 0 {
+		t.Errorf("cache must be empty: got = %v", got)
+	}
+}
+
+func TestWithShardHasher(t *testing.T) {
+	const (
+		shards = 4
+		cap    = 4000
+		count  = 1000
+	)
+
+	// Sequential numeric keys sharing a long prefix
+	keys := make([]Key, count)
+	for i := range keys {
+		keys[i] = Key("tenant:42:user:" + strconv.Itoa(i))
+	}
+
+	cases := []struct {
+		name    string
+		options []ShardOption
+		min     int
+		max     int
+	}{
+		{"default", nil, count/shards - count/10, count/shards + count/10},
+		{"even", []ShardOption{WithShardHasher(func(key Key) uint64 {
+			n, _ := strconv.Atoi(string(key[len("tenant:42:user:"):]))
+			return uint64(n)
+		})}, count / shards, count / shards},
+		{"constant", []ShardOption{WithShardHasher(func(Key) uint64 { return 0 })}, 0, count},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cache, _ := NewSharded(shards, cap, tt.options...)
+			for _, key := range keys {
+				cache.Set(key, 0)
+			}
+
+			for i, shard := range cache.shards {
+				if got := shard.Len(); got < tt.min || got > tt.max {
+					t.Errorf("shard %v is out of balance: got = %v, want in [%v, %v]", i, got, tt.min, tt.max)
+				}
+			}
+
+			for _, key := range keys {
+				if !cache.Contains(key) || !cache.Delete(key) {
+					t.Errorf("hasher must route Set, Contains and Delete to the same shard: %v", key)
+				}
+			}
+		})
+	}
+}
+
+func TestReshardTo(t *testing.T) {
+	t.Run("entries survive", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			shards    = 4
+			newShards = 8
+			cap       = 800
+			count     = 400
+			ttl       = time.Minute
+		)
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		cache, _ := NewSharded(shards, cap, WithShardCacheOptions(WithNowFunc(func() time.Time { return now })))
+		defer cache.Close()
+
+		expiresAt := now.Add(ttl)
+		for i := range count {
+			cache.shard(IntKey(i)).SetWithExpiry(IntKey(i), i, expiresAt)
+		}
+
+		if err := cache.ReshardTo(newShards); err != nil {
+			t.Fatalf("got = %v, want = <nil>", err)
+		}
+
+		if got := len(cache.shards); got != newShards {
+			t.Errorf("invalid number of shards: got = %v, want = %v", got, newShards)
+		}
+		if got := cache.Len(); got != count {
+			t.Errorf("invalid length: got = %v, want = %v", got, count)
+		}
+
+		for i := range count {
+			if got, ok := cache.Get(IntKey(i)); !ok || got != i {
+				t.Errorf("got = %v, want = %v", got, i)
+			}
+			if got, _ := cache.shard(IntKey(i)).Expiry(IntKey(i)); !got.Equal(expiresAt) {
+				t.Errorf("expiry must be kept: got = %v, want = %v", got, expiresAt)
+			}
+		}
+
+		now = expiresAt
+		if cache.Contains(IntKey(0)) {
+			t.Error("moved element must expire")
+		}
+	})
+
+	t.Run("eviction callback calls the cache", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			shards    = 2
+			newShards = 3
+			cap       = 6
+			timeout   = time.Second
+		)
+		var cache *ShardedCache
+		var evicted atomic.Int64
+		cache, _ = NewSharded(shards, cap, WithShardCacheOptions(WithOnEvict(func(key Key, _ any, _ EvictReason) {
+			evicted.Add(1)
+			cache.Contains(key)
+		})))
+		for i := range cap {
+			cache.Set(IntKey(i), i)
+		}
+
+		done := make(chan error)
+		go func() { done <- cache.ReshardTo(newShards) }()
+
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("got = %v, want = <nil>", err)
+			}
+		case <-time.After(timeout):
+			t.Fatal("resharding with a callback calling the cache deadlocked")
+		}
+
+		if evicted.Load() == 0 {
+			t.Error("a new shard must overflow to run the callback")
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			shards = 2
+			cap    = 4
+		)
+		cache, _ := NewSharded(shards, cap)
+		if err := cache.ReshardTo(0); err == nil {
+			t.Error("error expected for zero shards")
+		}
+		if err := cache.ReshardTo(cap + 1); err == nil {
+			t.Error("error expected for cap less than shards")
+		}
+	})
+}
@@ -0,0 +1,68 @@
+package lrucache
+
+import (
+	"container/list"
+	"errors"
+	"unsafe"
+)
+
+// Estimated size of element bookkeeping: list item, list element and hash table entry
+const entryOverhead = int64(unsafe.Sizeof(listItem{}) + unsafe.Sizeof(list.Element{}) + unsafe.Sizeof(Key("")) + unsafe.Sizeof((*list.Element)(nil)))
+
+// Estimated size of values of types other than string and []byte
+const defaultValueSize = int64(unsafe.Sizeof(any(nil)))
+
+// Sets max bytes option: element cost is estimated from its size and elements are evicted
+// to keep the total under maxBytes. Size of string and []byte values is their length,
+// other values count as defaultValueSize regardless of what they reference, so the budget
+// bounds real memory only for string and []byte values. Every element adds entryOverhead
+// and its key length. SetWithCost with positive cost overrides the estimate.
+// An element bigger than the whole budget is rejected like a too long key (see WithMaxKeyLen),
+// so the total never exceeds maxBytes.
+func WithMaxBytes(maxBytes int64) Option {
+	return func(l *LRUCache) error {
+		if maxBytes <= 0 {
+			return errors.New("max bytes must be positive")
+		}
+
+		l.maxCost = maxBytes
+		l.estimateCost = true
+		return nil
+	}
+}
+
+// Estimates memory used by the element
+func estimateSize(key Key, value any) int64 {
+	size := entryOverhead + int64(len(key))
+	switch v := value.(type) {
+	case string:
+		size += int64(len(v))
+	case []byte:
+		size += int64(len(v))
+	default:
+		size += defaultValueSize
+	}
+	return size
+}
+
+// Checks if the element can't fit the max bytes budget even alone, see WithMaxBytes
+func (l *LRUCache) oversized(key Key, value any) bool {
+	return l.estimateCost && estimateSize(key, value) > l.maxCost
+}
+
+// Changes element cost evicting other elements until the total cost fits max cost.
+// The node itself is never evicted: when it is the policy victim the next one is taken.
+// Oversized values are rejected before they get here, so the node alone always fits.
+func (l *LRUCache) resize(node *list.Element, cost int64) {
+	item := node.Value.(*listItem)
+	l.cost += cost - item.cost
+	item.cost = cost
+
+	for l.maxCost > 0 && l.cost > l.maxCost {
+		victim := l.evictor.Victim()
+		if victim == node {
+			victim = l.evictor.After(node)
+		}
+		l.evict(victim, EvictCapacity)
+	}
+}
@@ -0,0 +1,174 @@
+package lrucache
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestEstimateSize(t *testing.T) {
+	cases := []struct {
+		name  string
+		key   Key
+		value any
+		want  int64
+	}{
+		{"string", "k", "hello", entryOverhead + 1 + 5},
+		{"bytes", "key", make([]byte, 100), entryOverhead + 3 + 100},
+		{"other", "key", 42, entryOverhead + 3 + defaultValueSize},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := estimateSize(tt.key, tt.value); got != tt.want {
+				t.Errorf("got = %v, want = %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithMaxBytes(t *testing.T) {
+	t.Run("eviction keeps budget", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap       = 100
+			valueSize = 1000
+			fit       = 5
+			count     = 20
+		)
+		maxBytes := fit * estimateSize("00", make([]byte, valueSize))
+		cache, _ := New(cap, WithMaxBytes(maxBytes))
+
+		for i := range count {
+			key := Key(strconv.Itoa(10 + i))
+			cache.Set(key, make([]byte, valueSize))
+
+			if cache.cost > maxBytes {
+				t.Fatalf("budget exceeded: got = %v, want <= %v", cache.cost, maxBytes)
+			}
+		}
+
+		if got := cache.Len(); got != fit {
+			t.Errorf("invalid length: got = %v, want = %v", got, fit)
+		}
+
+		if !cache.Contains(Key(strconv.Itoa(10 + count - 1))) {
+			t.Error("most recent element must be kept")
+		}
+	})
+
+	t.Run("update changes size", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap       = 100
+			valueSize = 1000
+		)
+		maxBytes := 3 * estimateSize("k0", make([]byte, valueSize))
+		cache, _ := New(cap, WithMaxBytes(maxBytes))
+		cache.Set("k0", make([]byte, valueSize))
+		cache.Set("k1", make([]byte, valueSize))
+		cache.Set("k2", "")
+
+		cache.Set("k2", make([]byte, 2*valueSize))
+
+		if cache.Contains("k0") || !cache.Contains("k1") || !cache.Contains("k2") {
+			t.Errorf("growing update must evict the least recent element: got = %v", cache.Snapshot())
+		}
+
+		if cache.cost > maxBytes {
+			t.Errorf("budget exceeded: got = %v, want <= %v", cache.cost, maxBytes)
+		}
+	})
+
+	t.Run("oversized value is rejected", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap       = 100
+			valueSize = 1000
+		)
+		maxBytes := 2 * estimateSize("k0", make([]byte, valueSize))
+		cache, _ := New(cap, WithMaxBytes(maxBytes))
+		cache.Set("k0", make([]byte, valueSize))
+		cache.Set("k1", make([]byte, valueSize))
+
+		huge := make([]byte, 3*valueSize)
+		if cache.Set("k2", huge) || cache.Contains("k2") {
+			t.Error("oversized value must not be added")
+		}
+		if cache.Update("k0", huge) {
+			t.Error("oversized update must be rejected")
+		}
+		if _, replaced := cache.Swap("k1", huge); replaced {
+			t.Error("oversized swap must be rejected")
+		}
+		cache.Warm([]Entry{{Key: "k3", Value: huge}})
+		cache.SetMultiWithTTL(map[Key]any{"k4": huge}, 0)
+
+		if got := cache.Len(); got != 2 {
+			t.Errorf("other elements must be kept: got length = %v, want = %v", got, 2)
+		}
+		if cache.cost > maxBytes {
+			t.Errorf("budget exceeded: got = %v, want <= %v", cache.cost, maxBytes)
+		}
+	})
+
+	t.Run("invalid max bytes", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 2
+		if _, err := New(cap, WithMaxBytes(0)); err == nil {
+			t.Error("error expected")
+		}
+	})
+}
+
+func TestWithMaxBytesPolicies(t *testing.T) {
+	cases := []struct {
+		name   string
+		policy Policy
+	}{
+		{"lru", PolicyLRU},
+		{"lfu", PolicyLFU},
+		{"2q", Policy2Q},
+		{"fifo", PolicyFIFO},
+		{"random", PolicyRandom},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			const (
+				cap    = 4
+				rounds = 20
+				reads  = 5
+			)
+			maxBytes := 2*entryOverhead + 32
+			for range rounds {
+				cache, _ := New(cap, WithMaxBytes(maxBytes), WithEvictionPolicy(tt.policy))
+				cache.Set("c", "x")
+				cache.Set("a", 1)
+				for range reads {
+					cache.Get("a")
+				}
+
+				cache.Set("c", strings.Repeat("x", 25))
+
+				if cache.cost > maxBytes {
+					t.Fatalf("budget exceeded: got = %v, want <= %v", cache.cost, maxBytes)
+				}
+				if got, _ := cache.Peek("c"); got != strings.Repeat("x", 25) {
+					t.Fatalf("updated element must be kept: got = %v", got)
+				}
+				if err := cache.Validate(); err != nil {
+					t.Fatalf("not expected error = %v", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,346 @@
+package lrucache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Backing store the cache loads missing values from
+type Source interface {
+	Load(key Key) (any, error)
+}
+
+var ErrNoSource = errors.New("source isn't configured")
+
+// In-flight load shared by concurrent callers
+type call struct {
+	done    chan struct{} // closed when the load completes
+	value   any
+	err     error
+	waiters int                // callers waiting for the load
+	cancel  context.CancelFunc // cancels the load context, nil if the load has no context
+}
+
+// Deduplicates concurrent loads of the same key
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[Key]*call
+}
+
+// Runs fn once for all concurrent callers with the same key
+func (g *flightGroup) Do(key Key, fn func() (any, error)) (any, error) {
+	c, leader := g.join(key)
+	defer g.leave(key, c)
+	if leader {
+		g.run(key, c, fn)
+	}
+
+	<-c.done
+	return c.value, c.err
+}
+
+// Runs fn once for all concurrent callers with the same key in a separate goroutine,
+// so every caller stops waiting when its context is done. fn gets a context carrying
+// the first caller's values and deadline, it's cancelled only when every caller including
+// Do callers has stopped waiting.
+func (g *flightGroup) DoContext(ctx context.Context, key Key, fn func(context.Context) (any, error)) (any, error) {
+	c, leader := g.join(key)
+
+	g.mu.Lock()
+	if leader {
+		loadCtx, cancel := context.WithoutCancel(ctx), context.CancelFunc(nil)
+		if deadline, ok := ctx.Deadline(); ok {
+			loadCtx, cancel = context.WithDeadline(loadCtx, deadline)
+		} else {
+			loadCtx, cancel = context.WithCancel(loadCtx)
+		}
+		c.cancel = cancel
+		go g.run(key, c, func() (any, error) {
+			defer cancel()
+			return fn(loadCtx)
+		})
+	}
+	g.mu.Unlock()
+	defer g.leave(key, c)
+
+	select {
+	case <-c.done:
+		return c.value, c.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Finds in-flight call of the key or registers a new one and counts the caller as its waiter,
+// every join must be paired with leave
+// Return: true - the caller must run the new call, false - the call is in flight
+func (g *flightGroup) join(key Key) (*call, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if c, exist := g.calls[key]; exist {
+		c.waiters++
+		return c, false
+	}
+
+	if g.calls == nil {
+		g.calls = make(map[Key]*call)
+	}
+	c := &call{done: make(chan struct{}), waiters: 1}
+	g.calls[key] = c
+	return c, true
+}
+
+// Unregisters the caller, the last one leaving cancels the load of DoContext,
+// so later callers start a new load instead of joining the cancelled one
+func (g *flightGroup) leave(key Key, c *call) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	c.waiters--
+	if c.waiters > 0 || c.cancel == nil {
+		return
+	}
+
+	c.cancel()
+	if g.calls[key] == c {
+		delete(g.calls, key)
+	}
+}
+
+// Runs the call and unregisters it
+func (g *flightGroup) run(key Key, c *call, fn func() (any, error)) {
+	c.value, c.err = fn()
+
+	g.mu.Lock()
+	if g.calls[key] == c {
+		delete(g.calls, key)
+	}
+	g.mu.Unlock()
+
+	close(c.done)
+}
+
+// Sets read-through source option.
+// Get and Load fall back to the source on a miss, concurrent loads of the same key are deduplicated.
+// Loaded values are cached, errors aren't.
+func WithSource(src Source) Option {
+	return func(l *LRUCache) error {
+		if src == nil {
+			return errors.New("source must not be nil")
+		}
+
+		l.source = src
+		return nil
+	}
+}
+
+// Sets max concurrent loads option.
+// At most n loader calls run simultaneously, the rest wait for a free slot.
+// Together with deduplication of the same key loads it bounds the backing store pressure.
+func WithMaxConcurrentLoads(n int) Option {
+	return func(l *LRUCache) error {
+		if n <= 0 {
+			return errors.New("max concurrent loads must be positive")
+		}
+
+		l.loadSlots = make(chan struct{}, n)
+		return nil
+	}
+}
+
+// Gets value from cache or loads it by loader on a miss.
+// Concurrent loads of the same key are deduplicated, loaded values are cached, errors aren't.
+func (l *LRUCache) GetOrLoad(key Key, loader func(Key) (any, error)) (any, error) {
+	if value, exist := l.get(key); exist {
+		return value, nil
+	}
+	return l.load(key, loader)
+}
+
+// Gets value from cache loading it from the source on a miss
+// Return: value or the source error, ErrNoSource if the source isn't configured
+func (l *LRUCache) Load(key Key) (any, error) {
+	if value, exist := l.get(key); exist {
+		return value, nil
+	}
+
+	if l.source == nil {
+		return nil, ErrNoSource
+	}
+	return l.load(key, l.source.Load)
+}
+
+// Gets value from cache or loads it by loader on a miss passing ctx to the loader.
+// Concurrent loads of the same key are deduplicated: the loader gets a context carrying the first caller's
+// values and deadline, which is cancelled only when every caller (GetOrLoad, Get and Load callers
+// joining the load included) has stopped waiting, so one caller's cancellation doesn't fail the others. Every caller returns ctx.Err() as soon as its own context is done.
+// Loaded values are cached, errors aren't.
+func (l *LRUCache) GetOrLoadContext(ctx context.Context, key Key, loader func(context.Context) (any, error)) (any, error) {
+	if value, exist := l.get(key); exist {
+		return value, nil
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return l.loads.DoContext(ctx, key, func(ctx context.Context) (any, error) {
+		if l.loadSlots != nil {
+			select {
+			case l.loadSlots <- struct{}{}:
+				defer func() { <-l.loadSlots }()
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		value, err := loader(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		l.Set(key, value)
+		return value, nil
+	})
+}
+
+// Sets refresh-ahead option: a read hitting an element that expires within window reloads it
+// from the source in the background and returns the current value meanwhile.
+// Only one load of the key runs at a time, a background reload is shared with concurrent misses.
+// Reload errors are dropped, the element expires as usual. Requires WithSource.
+func WithRefreshAhead(window time.Duration) Option {
+	return func(l *LRUCache) error {
+		if window <= 0 {
+			return errors.New("refresh-ahead window must be positive")
+		}
+
+		l.refreshAhead = window
+		return nil
+	}
+}
+
+// Loads value by loader once for concurrent callers and caches it
+func (l *LRUCache) load(key Key, loader func(Key) (any, error)) (any, error) {
+	return l.loads.Do(key, l.caching(key, loader))
+}
+
+// Reloads value from the source in the background unless a load of the key is in flight
+func (l *LRUCache) reload(key Key) {
+	c, leader := l.loads.join(key)
+	if !leader {
+		l.loads.leave(key, c)
+		return
+	}
+
+	go func() {
+		defer l.loads.leave(key, c)
+		l.loads.run(key, c, l.caching(key, l.source.Load))
+	}()
+}
+
+// Wraps loader to wait for a load slot and to cache the loaded value
+func (l *LRUCache) caching(key Key, loader func(Key) (any, error)) func() (any, error) {
+	return func() (any, error) {
+		if l.loadSlots != nil {
+			l.loadSlots <- struct{}{}
+			defer func() { <-l.loadSlots }()
+		}
+
+		value, err := loader(key)
+		if err != nil {
+			return nil, err
+		}
+
+		l.Set(key, value)
+		return value, nil
+	}
+}
+
+// Sets write-through option: Set and SetThrough pass every value to store right after
+// the cache is updated. store is called under the cache lock (see WithKeyLocks to avoid it),
+// so the store sees writes in the cache order, and it must not call the cache. Set ignores store errors and keeps
+// the new value, SetThrough returns them and rolls the cache back.
+// Other adding methods don't write through.
+func WithWriteThrough(store func(Key, any) error) Option {
+	return func(l *LRUCache) error {
+		if store == nil {
+			return errors.New("write-through store must not be nil")
+		}
+
+		l.writeThrough = store
+		return nil
+	}
+}
+
+// Adds value to cache like Set and writes it through to the store, see WithWriteThrough.
+// If the store fails, the cache is rolled back: the previous value is restored or the new
+// element is deleted. Elements evicted to free space and refreshed ttl aren't restored.
+// Without the store it's the same as Set.
+// Return: true - existing element was updated, false - new element was added; store error
+func (l *LRUCache) SetThrough(key Key, value any) (bool, error) {
+	if l.rejects(key) || l.oversized(key, value) {
+		return false, nil
+	}
+
+	return l.write(key, value, true)
+}
+
+// Adds value to cache and writes it through to the store under the cache lock,
+// rolls the cache back on store error if rollback is set
+func (l *LRUCache) set(key Key, value any, rollback bool) (bool, error) {
+	node, updated, old, stored := l.put(key, value)
+	if !stored || l.writeThrough == nil {
+		return updated, nil
+	}
+
+	err := l.writeThrough(key, value)
+	if err != nil && rollback {
+		l.restore(key, node, updated, old)
+	}
+	return updated, err
+}
+
+// Adds value to cache without writing it through
+// Return: node of the element, true - existing element was updated, the previous value,
+// false - nil value was rejected (see WithRejectNilValues) and nothing was stored
+func (l *LRUCache) put(key Key, value any) (*list.Element, bool, any, bool) {
+	if l.deletesNil(key, value) {
+		return nil, false, nil, false
+	}
+
+	node, updated := l.lookup(key)
+	var old any
+	if updated {
+		old = node.Value.(*listItem).value
+		l.promote(node, value)
+	} else {
+		l.insert(key, value, 0)
+		node = l.items[key]
+	}
+	return node, updated, old, true
+}
+
+// Rolls back the write to the node: restores the previous value or deletes the new element.
+// Nothing changes if the element was deleted or replaced meanwhile.
+func (l *LRUCache) restore(key Key, node *list.Element, updated bool, old any) {
+	if l.items[key] != node {
+		return
+	}
+
+	if !updated {
+		l.deleteItem(node)
+		return
+	}
+
+	item := node.Value.(*listItem)
+	l.unindexValue(item)
+	item.value = old
+	l.indexValue(item)
+	if l.estimateCost {
+		l.resize(node, estimateSize(key, old))
+	}
+}
@@ -0,0 +1,577 @@
+package lrucache
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type fakeSource struct {
+	loads   int64
+	delay   time.Duration
+	values  map[Key]any
+	failure error
+}
+
+func (s *fakeSource) Load(key Key) (any, error) {
+	atomic.AddInt64(&s.loads, 1)
+	time.Sleep(s.delay)
+
+	if s.failure != nil {
+		return nil, s.failure
+	}
+	return s.values[key], nil
+}
+
+func TestWithSource(t *testing.T) {
+	t.Run("load on miss", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 2
+		src := &fakeSource{values: map[Key]any{"one": 1}}
+		cache, _ := New(cap, WithSource(src))
+
+		for range 3 {
+			value, exist := cache.Get("one")
+			if !exist || value != 1 {
+				t.Errorf("loaded value expected: got = %v, %v", value, exist)
+			}
+		}
+
+		if got := atomic.LoadInt64(&src.loads); got != 1 {
+			t.Errorf("loaded value must be cached: got loads = %v, want = 1", got)
+		}
+	})
+
+	t.Run("error propagation", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 2
+		failure := errors.New("backend is down")
+		src := &fakeSource{failure: failure}
+		cache, _ := New(cap, WithSource(src))
+
+		if _, exist := cache.Get("one"); exist {
+			t.Error("false expected")
+		}
+
+		if _, err := cache.Load("one"); !errors.Is(err, failure) {
+			t.Errorf("source error expected: got = %v", err)
+		}
+
+		if cache.Contains("one") {
+			t.Error("error must not be cached")
+		}
+
+		if got := atomic.LoadInt64(&src.loads); got != 2 {
+			t.Errorf("invalid number of loads: got = %v, want = 2", got)
+		}
+	})
+
+	t.Run("concurrent misses load once", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap        = 2
+			goroutines = 10
+		)
+		src := &fakeSource{values: map[Key]any{"one": 1}, delay: 50 * time.Millisecond}
+		cache, _ := New(cap, WithSource(src))
+
+		var wg sync.WaitGroup
+		for range goroutines {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if value, err := cache.Load("one"); err != nil || value != 1 {
+					t.Errorf("loaded value expected: got = %v, %v", value, err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if got := atomic.LoadInt64(&src.loads); got != 1 {
+			t.Errorf("concurrent loads must be deduplicated: got loads = %v, want = 1", got)
+		}
+	})
+
+	t.Run("no source", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 2
+		cache, _ := New(cap)
+
+		if _, err := cache.Load("one"); !errors.Is(err, ErrNoSource) {
+			t.Errorf("ErrNoSource expected: got = %v", err)
+		}
+	})
+}
+
+func TestGetOrLoad(t *testing.T) {
+	t.Run("load and cache", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 2
+		cache, _ := New(cap)
+
+		var loads int
+		loader := func(key Key) (any, error) {
+			loads++
+			return string(key) + "!", nil
+		}
+
+		for range 2 {
+			value, err := cache.GetOrLoad("one", loader)
+			if err != nil || value != "one!" {
+				t.Errorf("loaded value expected: got = %v, %v", value, err)
+			}
+		}
+
+		if loads != 1 {
+			t.Errorf("loaded value must be cached: got loads = %v, want = 1", loads)
+		}
+	})
+
+	t.Run("max concurrent loads", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap      = 100
+			maxLoads = 3
+			keys     = 20
+		)
+		cache, _ := New(cap, WithMaxConcurrentLoads(maxLoads))
+
+		var running, peak int64
+		loader := func(key Key) (any, error) {
+			n := atomic.AddInt64(&running, 1)
+			defer atomic.AddInt64(&running, -1)
+
+			for {
+				p := atomic.LoadInt64(&peak)
+				if n <= p || atomic.CompareAndSwapInt64(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			return key, nil
+		}
+
+		var wg sync.WaitGroup
+		for i := range keys {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				cache.GetOrLoad(Key(strconv.Itoa(i)), loader)
+			}()
+		}
+		wg.Wait()
+
+		if got := atomic.LoadInt64(&peak); got > maxLoads {
+			t.Errorf("concurrent loads exceed limit: got = %v, want <= %v", got, maxLoads)
+		}
+
+		if got := cache.Len(); got != keys {
+			t.Errorf("all keys must be loaded: got = %v, want = %v", got, keys)
+		}
+	})
+}
+
+func TestGetOrLoadContext(t *testing.T) {
+	t.Run("load and cache", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 2
+		cache, _ := New(cap)
+
+		var loads int
+		loader := func(context.Context) (any, error) {
+			loads++
+			return 1, nil
+		}
+
+		for range 2 {
+			value, err := cache.GetOrLoadContext(context.Background(), "one", loader)
+			if err != nil || value != 1 {
+				t.Errorf("loaded value expected: got = %v, %v", value, err)
+			}
+		}
+
+		if loads != 1 {
+			t.Errorf("loaded value must be cached: got loads = %v, want = 1", loads)
+		}
+	})
+
+	t.Run("cancel waiter mid-load", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap     = 2
+			timeout = time.Second
+		)
+		cache, _ := New(cap)
+
+		started, release := make(chan struct{}), make(chan struct{})
+		loader := func(context.Context) (any, error) {
+			close(started)
+			<-release
+			return 1, nil
+		}
+
+		leaderDone := make(chan struct{})
+		go func() {
+			defer close(leaderDone)
+			if value, err := cache.GetOrLoadContext(context.Background(), "one", loader); err != nil || value != 1 {
+				t.Errorf("loaded value expected: got = %v, %v", value, err)
+			}
+		}()
+		<-started
+
+		ctx, cancel := context.WithCancel(context.Background())
+		errs := make(chan error)
+		go func() {
+			_, err := cache.GetOrLoadContext(ctx, "one", loader)
+			errs <- err
+		}()
+		cancel()
+
+		select {
+		case err := <-errs:
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("context error expected: got = %v", err)
+			}
+		case <-time.After(timeout):
+			t.Fatal("waiter must return promptly after cancellation")
+		}
+
+		close(release)
+		<-leaderDone
+
+		if !cache.Contains("one") {
+			t.Error("load must complete for the other callers")
+		}
+	})
+
+	t.Run("leader cancels, follower gets value", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap     = 2
+			timeout = time.Second
+		)
+		cache, _ := New(cap)
+
+		started, release := make(chan struct{}), make(chan struct{})
+		loader := func(ctx context.Context) (any, error) {
+			close(started)
+			select {
+			case <-release:
+				return 1, nil
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		leaderErr := make(chan error)
+		go func() {
+			_, err := cache.GetOrLoadContext(ctx, "one", loader)
+			leaderErr <- err
+		}()
+		<-started
+
+		followerDone := make(chan struct{})
+		go func() {
+			defer close(followerDone)
+			if value, err := cache.GetOrLoadContext(context.Background(), "one", loader); err != nil || value != 1 {
+				t.Errorf("loaded value expected: got = %v, %v", value, err)
+			}
+		}()
+
+		// Wait for the follower to join the load
+		deadline := time.Now().Add(timeout)
+		for {
+			cache.loads.mu.Lock()
+			waiters := cache.loads.calls["one"].waiters
+			cache.loads.mu.Unlock()
+			if waiters == 2 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("follower must join the load")
+			}
+			time.Sleep(time.Millisecond)
+		}
+
+		cancel()
+		if err := <-leaderErr; !errors.Is(err, context.Canceled) {
+			t.Errorf("leader must get its own context error: got = %v", err)
+		}
+
+		close(release)
+		<-followerDone
+	})
+
+	t.Run("context passed to loader", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 2
+		cache, _ := New(cap)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		_, err := cache.GetOrLoadContext(ctx, "one", func(ctx context.Context) (any, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("deadline error expected: got = %v", err)
+		}
+
+		if cache.Contains("one") {
+			t.Error("error must not be cached")
+		}
+	})
+
+	t.Run("leader cancels, GetOrLoad follower gets value", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap     = 2
+			timeout = time.Second
+		)
+		cache, _ := New(cap)
+
+		started, release := make(chan struct{}), make(chan struct{})
+		loader := func(ctx context.Context) (any, error) {
+			close(started)
+			select {
+			case <-release:
+				return 1, nil
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		leaderErr := make(chan error)
+		go func() {
+			_, err := cache.GetOrLoadContext(ctx, "one", loader)
+			leaderErr <- err
+		}()
+		<-started
+
+		followerDone := make(chan struct{})
+		go func() {
+			defer close(followerDone)
+			if value, err := cache.GetOrLoad("one", func(Key) (any, error) { return 2, nil }); err != nil || value != 1 {
+				t.Errorf("shared loaded value expected: got = %v, %v", value, err)
+			}
+		}()
+
+		// Wait for the follower to join the load
+		deadline := time.Now().Add(timeout)
+		for {
+			cache.loads.mu.Lock()
+			waiters := cache.loads.calls["one"].waiters
+			cache.loads.mu.Unlock()
+			if waiters == 2 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("follower must join the load")
+			}
+			time.Sleep(time.Millisecond)
+		}
+
+		cancel()
+		if err := <-leaderErr; !errors.Is(err, context.Canceled) {
+			t.Errorf("leader must get its own context error: got = %v", err)
+		}
+
+		close(release)
+		<-followerDone
+	})
+
+	t.Run("deadline passed to loader", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap     = 2
+			timeout = time.Minute
+		)
+		cache, _ := New(cap)
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		want, _ := ctx.Deadline()
+
+		_, err := cache.GetOrLoadContext(ctx, "one", func(ctx context.Context) (any, error) {
+			if got, ok := ctx.Deadline(); !ok || !got.Equal(want) {
+				t.Errorf("got = %v, want = %v", got, want)
+			}
+			return 1, nil
+		})
+		if err != nil {
+			t.Errorf("not expected error = %v", err)
+		}
+	})
+
+	t.Run("cancelled before load", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 2
+		cache, _ := New(cap)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := cache.GetOrLoadContext(ctx, "one", func(context.Context) (any, error) {
+			t.Error("loader must not be called")
+			return nil, nil
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("context error expected: got = %v", err)
+		}
+	})
+}
+
+func TestWithWriteThrough(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 5
+		store := make(map[Key]any)
+		cache, _ := New(cap, WithWriteThrough(func(key Key, value any) error {
+			store[key] = value
+			return nil
+		}))
+
+		cache.Set("one", 1)
+		if updated, err := cache.SetThrough("one", 2); !updated || err != nil {
+			t.Errorf("got = %v, %v, want = true, <nil>", updated, err)
+		}
+
+		if got := store["one"]; got != 2 {
+			t.Errorf("got store value = %v, want = %v", got, 2)
+		}
+		if got, _ := cache.Peek("one"); got != 2 {
+			t.Errorf("got cache value = %v, want = %v", got, 2)
+		}
+	})
+
+	t.Run("failing store", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 5
+		failure := errors.New("store is down")
+		var fail bool
+		cache, _ := New(cap, WithWriteThrough(func(Key, any) error {
+			if fail {
+				return failure
+			}
+			return nil
+		}))
+		cache.Set("one", 1)
+		fail = true
+
+		if updated, err := cache.SetThrough("one", 2); !updated || !errors.Is(err, failure) {
+			t.Errorf("got = %v, %v, want = true, %v", updated, err, failure)
+		}
+		if got, _ := cache.Peek("one"); got != 1 {
+			t.Errorf("update must be rolled back: got = %v, want = %v", got, 1)
+		}
+
+		if updated, err := cache.SetThrough("two", 2); updated || !errors.Is(err, failure) {
+			t.Errorf("got = %v, %v, want = false, %v", updated, err, failure)
+		}
+		if cache.Contains("two") {
+			t.Error("insert must be rolled back")
+		}
+
+		cache.Set("three", 3)
+		if got, _ := cache.Peek("three"); got != 3 {
+			t.Errorf("Set must keep the value: got = %v, want = %v", got, 3)
+		}
+	})
+
+	t.Run("nil store", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 5
+		if _, err := New(cap, WithWriteThrough(nil)); err == nil {
+			t.Error("got = <nil>, want error")
+		}
+	})
+}
+
+func TestWithRefreshAhead(t *testing.T) {
+	t.Run("reload near expiry", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap    = 2
+			ttl    = time.Minute
+			window = 10 * time.Second
+			ticks  = 2
+			reads  = 5
+		)
+		src := &fakeSource{values: map[Key]any{"one": 2}, delay: 50 * time.Millisecond}
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		cache, _ := New(cap, WithSource(src), WithRefreshAhead(window),
+			WithNowFunc(func() time.Time { return now }), WithTTLPaused(ttl, ticks))
+		cache.SetWithExpiry("one", 1, now.Add(ttl))
+		now = now.Add(ttl - window/2)
+
+		for range reads {
+			if value, exist := cache.Get("one"); !exist || value != 1 {
+				t.Errorf("current value expected: got = %v, %v", value, exist)
+			}
+		}
+
+		deadline := time.Now().Add(time.Second)
+		for value, _ := cache.Peek("one"); value != 2; value, _ = cache.Peek("one") {
+			if time.Now().After(deadline) {
+				t.Fatalf("value wasn't reloaded: got = %v, want = %v", value, 2)
+			}
+			time.Sleep(time.Millisecond)
+		}
+
+		if got := atomic.LoadInt64(&src.loads); got != 1 {
+			t.Errorf("reloads must be deduplicated: got loads = %v, want = 1", got)
+		}
+	})
+
+	t.Run("far from expiry", func(t *testing.T) {
+		t.Parallel()
+
+		const (
+			cap    = 2
+			ttl    = time.Minute
+			window = 10 * time.Second
+			ticks  = 2
+		)
+		src := &fakeSource{values: map[Key]any{"one": 2}}
+		cache, _ := New(cap, WithSource(src), WithRefreshAhead(window), WithTTLPaused(ttl, ticks))
+		cache.Set("one", 1)
+		cache.Get("one")
+
+		if got := atomic.LoadInt64(&src.loads); got != 0 {
+			t.Errorf("got loads = %v, want = 0", got)
+		}
+	})
+
+	t.Run("invalid window", func(t *testing.T) {
+		t.Parallel()
+
+		const cap = 2
+		if _, err := New(cap, WithRefreshAhead(0)); err == nil {
+			t.Error("got = <nil>, want error")
+		}
+	})
+}